@@ -0,0 +1,198 @@
+package cdi_reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/cdi_spec_gen"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/rs/zerolog"
+	"sigs.k8s.io/yaml"
+	"tags.cncf.io/container-device-interface/specs-go"
+)
+
+// DeviceSource returns the devices which can be allocated currently.
+type DeviceSource func() []furiosa_device.FuriosaDevice
+
+// Diff is the difference between the CDI spec on disk and the devices of the device plugin, by CDI device name.
+type Diff struct {
+	// Added are the devices missing in the spec on disk.
+	Added []string
+	// Removed are the stale devices in the spec on disk.
+	Removed []string
+	// Changed are the devices whose container edits on disk are outdated.
+	Changed []string
+}
+
+// Empty returns whether the spec on disk matches the devices.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("added [%s], removed [%s], changed [%s]", strings.Join(d.Added, ", "), strings.Join(d.Removed, ", "), strings.Join(d.Changed, ", "))
+}
+
+// Reconciler owns the CDI spec file of the device plugin and keeps it in sync with the devices which can be allocated.
+type Reconciler struct {
+	specDir string
+	devices DeviceSource
+
+	mu sync.Mutex
+}
+
+// NewReconciler returns Reconciler of the spec file cdi_spec_gen.DefaultSpecFileName in the spec dir.
+func NewReconciler(specDir string, devices DeviceSource) *Reconciler {
+	return &Reconciler{
+		specDir: specDir,
+		devices: devices,
+	}
+}
+
+// Path returns the path of the spec file owned by Reconciler.
+func (r *Reconciler) Path() string {
+	return filepath.Join(r.specDir, cdi_spec_gen.DefaultSpecFileName)
+}
+
+// Verify compares the spec on disk with the devices without modifying the spec.
+func (r *Reconciler) Verify() (Diff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, diff, err := r.diff()
+	return diff, err
+}
+
+// Reconcile rewrites the spec atomically if it doesn't match the devices, and returns the difference it fixed.
+func (r *Reconciler) Reconcile() (Diff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	desired, diff, err := r.diff()
+	if err != nil {
+		return diff, err
+	}
+
+	if diff.Empty() {
+		return diff, nil
+	}
+
+	// a spec without devices is invalid, so the spec is removed if every device is disappeared or disabled.
+	if len(desired.Raw().Devices) == 0 {
+		return diff, r.remove()
+	}
+
+	return diff, desired.Write()
+}
+
+// Run reconciles the spec at the interval until the context is done, and removes the spec on return.
+func (r *Reconciler) Run(ctx context.Context, logger zerolog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Cleanup(); err != nil {
+				logger.Err(err).Msg(fmt.Sprintf("couldn't remove cdi spec %s", r.Path()))
+			}
+			return
+
+		case <-ticker.C:
+			diff, err := r.Reconcile()
+			if err != nil {
+				logger.Err(err).Msg(fmt.Sprintf("couldn't reconcile cdi spec %s", r.Path()))
+				continue
+			}
+
+			if !diff.Empty() {
+				logger.Info().Msg(fmt.Sprintf("cdi spec %s is rewritten: %s", r.Path(), diff))
+			}
+		}
+	}
+}
+
+// Cleanup removes the spec, so that no orphaned spec is left after the device plugin is stopped.
+func (r *Reconciler) Cleanup() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.remove()
+}
+
+func (r *Reconciler) remove() error {
+	if err := os.Remove(r.Path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// diff builds the desired spec from the devices and compares it with the spec on disk.
+// A spec on disk which couldn't be read is regarded as empty, so that it is overwritten.
+func (r *Reconciler) diff() (cdi_spec_gen.Spec, Diff, error) {
+	desired, err := device_manager.NewCDISpec(r.specDir, r.devices()...)
+	if err != nil {
+		return nil, Diff{}, err
+	}
+
+	current := r.readSpec()
+	sameKind := current.Kind == desired.Raw().Kind && current.Version == desired.Raw().Version
+
+	currentDevices := make(map[string]specs.Device, len(current.Devices))
+	for _, device := range current.Devices {
+		currentDevices[device.Name] = device
+	}
+
+	var diff Diff
+	for _, device := range desired.Raw().Devices {
+		currentDevice, exist := currentDevices[device.Name]
+		delete(currentDevices, device.Name)
+
+		switch {
+		case !exist:
+			diff.Added = append(diff.Added, device.Name)
+		case !sameKind || !equalDevice(device, currentDevice):
+			diff.Changed = append(diff.Changed, device.Name)
+		}
+	}
+
+	for name := range currentDevices {
+		diff.Removed = append(diff.Removed, name)
+	}
+	sort.Strings(diff.Removed)
+
+	return desired, diff, nil
+}
+
+func (r *Reconciler) readSpec() *specs.Spec {
+	spec := &specs.Spec{}
+
+	raw, err := os.ReadFile(r.Path())
+	if err != nil {
+		return spec
+	}
+
+	if err = yaml.Unmarshal(raw, spec); err != nil {
+		return &specs.Spec{}
+	}
+
+	return spec
+}
+
+// equalDevice compares the devices in their serialized form, which ignores the difference between nil and empty fields.
+func equalDevice(a, b specs.Device) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && string(rawA) == string(rawB)
+}
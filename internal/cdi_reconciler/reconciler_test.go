@@ -0,0 +1,141 @@
+package cdi_reconciler
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockFuriosaDevices(t *testing.T, policy furiosa_device.PartitioningPolicy, count int) []furiosa_device.FuriosaDevice {
+	devices, err := furiosa_device.NewFuriosaDevices(smi.GetStaticMockDevices(smi.ArchRngd)[:count], nil, policy)
+	assert.NoError(t, err)
+
+	return devices
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		description     string
+		before          func(t *testing.T, path string)
+		initial         []furiosa_device.FuriosaDevice
+		updated         []furiosa_device.FuriosaDevice
+		expectedDiff    Diff
+		expectedRemoved bool
+	}{
+		{
+			description:  "removed cards",
+			initial:      mockFuriosaDevices(t, furiosa_device.NonePolicy, 3),
+			updated:      mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			expectedDiff: Diff{Removed: []string{"A76AAD68-6855-40B1-9E86-D080852D1C81", "A76AAD68-6855-40B1-9E86-D080852D1C82"}},
+		},
+		{
+			description: "re-partitioned card",
+			initial:     mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			updated:     mockFuriosaDevices(t, furiosa_device.QuadCorePolicy, 1),
+			expectedDiff: Diff{
+				Added:   []string{"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3", "A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7"},
+				Removed: []string{"A76AAD68-6855-40B1-9E86-D080852D1C80"},
+			},
+		},
+		{
+			description: "modified spec",
+			before: func(t *testing.T, path string) {
+				raw, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				assert.NoError(t, os.WriteFile(path, []byte(strings.ReplaceAll(string(raw), "npu0bar4", "npu9bar4")), 0644))
+			},
+			initial:      mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			updated:      mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			expectedDiff: Diff{Changed: []string{"A76AAD68-6855-40B1-9E86-D080852D1C80"}},
+		},
+		{
+			description: "malformed spec",
+			before: func(t *testing.T, path string) {
+				assert.NoError(t, os.WriteFile(path, []byte("devices: {"), 0644))
+			},
+			initial:      mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			updated:      mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			expectedDiff: Diff{Added: []string{"A76AAD68-6855-40B1-9E86-D080852D1C80"}},
+		},
+		{
+			description:     "every card is gone",
+			initial:         mockFuriosaDevices(t, furiosa_device.NonePolicy, 1),
+			updated:         nil,
+			expectedDiff:    Diff{Removed: []string{"A76AAD68-6855-40B1-9E86-D080852D1C80"}},
+			expectedRemoved: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			devices := tc.initial
+			reconciler := NewReconciler(t.TempDir(), func() []furiosa_device.FuriosaDevice {
+				return devices
+			})
+
+			diff, err := reconciler.Reconcile()
+			assert.NoError(t, err)
+			assert.Len(t, diff.Added, len(tc.initial))
+			assert.FileExists(t, reconciler.Path())
+
+			if tc.before != nil {
+				tc.before(t, reconciler.Path())
+			}
+			devices = tc.updated
+
+			diff, err = reconciler.Verify()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDiff, diff)
+
+			diff, err = reconciler.Reconcile()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDiff, diff)
+
+			if tc.expectedRemoved {
+				assert.NoFileExists(t, reconciler.Path())
+				return
+			}
+
+			// the spec on disk matches the devices after reconcile.
+			diff, err = reconciler.Verify()
+			assert.NoError(t, err)
+			assert.True(t, diff.Empty(), diff.String())
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	devices := mockFuriosaDevices(t, furiosa_device.NonePolicy, 2)
+	reconciler := NewReconciler(t.TempDir(), func() []furiosa_device.FuriosaDevice {
+		return devices
+	})
+
+	_, err := reconciler.Reconcile()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		reconciler.Run(ctx, zerolog.Nop(), 10*time.Millisecond)
+		close(done)
+	}()
+
+	// a deleted spec is written again.
+	assert.NoError(t, os.Remove(reconciler.Path()))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(reconciler.Path())
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// the spec is removed on shutdown.
+	cancel()
+	<-done
+	assert.NoFileExists(t, reconciler.Path())
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/cdi_spec_gen"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// VersionV1 is the only configuration schema version understood by this plugin.
+	VersionV1 = "v1"
+
+	partitionedResourceNameExp = "%s-%dcore"
+
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultResourceDomain      = "furiosa.ai"
+	defaultPartitioningPolicy  = furiosa_device.NonePolicy
+	defaultAllocator           = ScoreBasedAllocator
+	defaultDeviceInjection     = LegacyDeviceInjection
+	// GetPreferredAllocation is on the critical path of kubelet admitting the pods.
+	defaultAllocationSearchBudget = 50 * time.Millisecond
+	defaultCDISpecDir             = cdi_spec_gen.DefaultDynamicDir
+
+	defaultUtilizationInterval = 500 * time.Millisecond
+	// the socket of the kubelet PodResources API.
+	defaultPodResourcesSocketPath = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+	defaultDeviceDiscoveryInterval = 30 * time.Second
+	// the driver creates the device nodes of every card under the directory.
+	defaultDeviceDiscoveryWatchPath = "/dev/rngd"
+)
+
+// AllocatorType selects the npu_allocator.NpuAllocator implementation used for GetPreferredAllocation.
+type AllocatorType string
+
+const (
+	ScoreBasedAllocator AllocatorType = "score-based"
+	BinPackingAllocator AllocatorType = "bin-packing"
+	// BranchAndBoundAllocator has the same objective as ScoreBasedAllocator, and scales to many partitioned cards.
+	BranchAndBoundAllocator AllocatorType = "branch-and-bound"
+	// SingleNUMAAllocator prefers the devices of a single NUMA node only, and has no preference if they don't fit in one.
+	SingleNUMAAllocator AllocatorType = "single-numa"
+	// SpreadAllocator spreads the devices across the PCIe switches for the jobs bound by the host bandwidth.
+	SpreadAllocator AllocatorType = "spread"
+)
+
+// DeviceInjectionMode selects how the allocated devices are injected into the containers.
+type DeviceInjectionMode string
+
+const (
+	// LegacyDeviceInjection returns the device nodes and the mounts in the Allocate response.
+	LegacyDeviceInjection DeviceInjectionMode = "legacy"
+	// CDIDeviceInjection returns the CDI device names in the Allocate response, which requires a container runtime supporting CDI.
+	CDIDeviceInjection DeviceInjectionMode = "cdi"
+	// BothDeviceInjection returns both of them for the container runtimes with and without CDI support.
+	BothDeviceInjection DeviceInjectionMode = "both"
+)
+
+// UsesCDI returns whether the CDI spec of the devices is required.
+func (m DeviceInjectionMode) UsesCDI() bool {
+	return m == CDIDeviceInjection || m == BothDeviceInjection
+}
+
+// UsesLegacy returns whether the device nodes and the mounts are returned in the Allocate response.
+// The empty mode is treated as legacy.
+func (m DeviceInjectionMode) UsesLegacy() bool {
+	return m != CDIDeviceInjection
+}
+
+// Config is the versioned configuration of the device plugin.
+// It is loaded from a YAML or JSON file and can be overridden by environment variables and command line flags.
+type Config struct {
+	Version             string                            `json:"version"`
+	DebugMode           bool                              `json:"debugMode"`
+	HealthCheckInterval metav1.Duration                   `json:"healthCheckInterval"`
+	ResourceDomain      string                            `json:"resourceDomain"`
+	PartitioningPolicy  furiosa_device.PartitioningPolicy `json:"partitioningPolicy"`
+	// ArchPartitioningPolicies overrides PartitioningPolicy for the given architectures, e.g. "rngd: dual-core".
+	ArchPartitioningPolicies map[string]furiosa_device.PartitioningPolicy `json:"archPartitioningPolicies,omitempty"`
+	// PartitioningGroups overrides ArchPartitioningPolicies and PartitioningPolicy for the selected cards.
+	PartitioningGroups []PartitioningGroup `json:"partitioningGroups,omitempty"`
+	Allocator          AllocatorType       `json:"allocator"`
+	// ResourceAllocators overrides Allocator for the given resources, e.g. "furiosa.ai/rngd: spread".
+	ResourceAllocators map[string]AllocatorType `json:"resourceAllocators,omitempty"`
+	// NUMAAffinity restricts the preferred allocation to the NUMA nodes which the kubelet Topology Manager aligns the
+	// devices to, so that the preference doesn't conflict with the single-numa-node and restricted policies.
+	NUMAAffinity bool `json:"numaAffinity"`
+	// AllocationSearchBudget bounds the search of the branch-and-bound allocator, which prefers the best allocation found
+	// so far when it expires. The search is never cut if it is zero.
+	AllocationSearchBudget metav1.Duration `json:"allocationSearchBudget"`
+	// ResourceNames renames the resources of the selected architectures, the devices of several architectures can be exposed
+	// under a single resource, e.g. "furiosa.ai/npu".
+	ResourceNames []ResourceNameConfig `json:"resourceNames,omitempty"`
+	// UnknownArch configures the cards of the architectures unknown to the device plugin.
+	UnknownArch UnknownArchConfig `json:"unknownArch"`
+	// BlockedDevices lists the cards reported as unhealthy regardless of their state, selected by UUID, serial, PCI BDF or index.
+	BlockedDevices []string `json:"blockedDevices,omitempty"`
+	// BlockedDevicesNodeAnnotation is the annotation key of the Node object holding comma separated selectors of blocked cards.
+	BlockedDevicesNodeAnnotation string `json:"blockedDevicesNodeAnnotation,omitempty"`
+	// NodeName is the name of the Node object running the device plugin, usually injected by the downward api.
+	NodeName string `json:"nodeName,omitempty"`
+	// HealthChecks enables the health checks performed in addition to the liveness of the devices.
+	HealthChecks HealthChecksConfig `json:"healthChecks"`
+	// HealthHysteresis damps transient changes of the device health reported to kubelet.
+	HealthHysteresis HealthHysteresisConfig `json:"healthHysteresis"`
+	// MetricsAddress is the address of the HTTP listener serving the metrics in Prometheus text format, e.g. ":9400".
+	// The listener is disabled when it is empty.
+	MetricsAddress string `json:"metricsAddress,omitempty"`
+	// Telemetry exports the telemetry of the cards such as power, temperature and utilization with the metrics.
+	Telemetry TelemetryConfig `json:"telemetry"`
+	// DeviceInjection selects how the allocated devices are injected into the containers.
+	DeviceInjection DeviceInjectionMode `json:"deviceInjection"`
+	// CDISpecDir is the directory where the CDI spec of the devices is written if DeviceInjection uses CDI.
+	CDISpecDir string `json:"cdiSpecDir"`
+	// PodResources attributes the allocated devices to the containers holding them through the kubelet PodResources API.
+	PodResources PodResourcesConfig `json:"podResources"`
+	// ContainerEnvs are injected into the containers in addition to the environment variables describing the allocated devices.
+	ContainerEnvs []ContainerEnv `json:"containerEnvs,omitempty"`
+	// DeviceDiscovery rediscovers the cards after startup, e.g. a card hot-plugged, enabled or disabled.
+	DeviceDiscovery DeviceDiscoveryConfig `json:"deviceDiscovery"`
+}
+
+// TelemetryConfig configures the telemetry of the cards exported with the metrics, it requires MetricsAddress.
+type TelemetryConfig struct {
+	Enabled bool `json:"enabled"`
+	// UtilizationInterval is the sampling interval of the performance counters used to calculate the PE utilization.
+	UtilizationInterval metav1.Duration `json:"utilizationInterval"`
+}
+
+func newDefaultTelemetryConfig() TelemetryConfig {
+	return TelemetryConfig{UtilizationInterval: metav1.Duration{Duration: defaultUtilizationInterval}}
+}
+
+// PodResourcesConfig configures the kubelet PodResources API client, it requires MetricsAddress.
+// The owners of the devices are attached to the telemetry and served at /pod-resources of the metrics listener.
+type PodResourcesConfig struct {
+	Enabled    bool   `json:"enabled"`
+	SocketPath string `json:"socketPath"`
+}
+
+func newDefaultPodResourcesConfig() PodResourcesConfig {
+	return PodResourcesConfig{SocketPath: defaultPodResourcesSocketPath}
+}
+
+// DeviceDiscoveryConfig configures the rediscovery of the cards.
+type DeviceDiscoveryConfig struct {
+	// Interval is the period of the rediscovery, the cards are discovered only at startup if it is zero.
+	Interval metav1.Duration `json:"interval"`
+	// WatchPaths are the directories of the device nodes, a change in them triggers the rediscovery immediately.
+	// A missing directory is ignored, and sysfs can't be watched since it doesn't notify changes.
+	WatchPaths []string `json:"watchPaths,omitempty"`
+}
+
+func newDefaultDeviceDiscoveryConfig() DeviceDiscoveryConfig {
+	return DeviceDiscoveryConfig{
+		Interval:   metav1.Duration{Duration: defaultDeviceDiscoveryInterval},
+		WatchPaths: []string{defaultDeviceDiscoveryWatchPath},
+	}
+}
+
+// ResourceNameConfig names the resource of the devices of the architectures partitioned with the policy.
+type ResourceNameConfig struct {
+	Archs []string `json:"archs"`
+	// Policy selects the partitioning policy. If it is empty, every policy is selected and the number of cores per partition
+	// is appended to Name for the partitioned devices, e.g. "npu-2core".
+	Policy furiosa_device.PartitioningPolicy `json:"policy,omitempty"`
+	// Domain overrides ResourceDomain.
+	Domain string `json:"domain,omitempty"`
+	Name   string `json:"name"`
+}
+
+// selects returns whether the devices of the arch partitioned with the policy are named by ResourceNameConfig.
+func (r ResourceNameConfig) selects(arch string, policy furiosa_device.PartitioningPolicy) bool {
+	if r.Policy != "" && r.Policy != policy {
+		return false
+	}
+
+	for _, selected := range r.Archs {
+		if selected == arch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnknownArchConfig configures the cards of the architectures unknown to the device plugin, e.g. a new SKU.
+// The cards are skipped with a warning unless ResourceName is given.
+type UnknownArchConfig struct {
+	// ResourceName registers the cards under ResourceDomain with the name, e.g. "npu-unknown".
+	ResourceName string `json:"resourceName,omitempty"`
+	// LabelNode labels the Node object with the number of the cards of unknown architectures, it requires NodeName.
+	LabelNode bool `json:"labelNode"`
+}
+
+// PartitioningGroup applies a partitioning policy to the cards selected by UUID, serial, PCI BDF or index.
+type PartitioningGroup struct {
+	Policy  furiosa_device.PartitioningPolicy `json:"policy"`
+	Devices []string                          `json:"devices"`
+}
+
+// NewDefaultConfig returns Config filled with the default values.
+func NewDefaultConfig() *Config {
+	return &Config{
+		Version:                VersionV1,
+		DebugMode:              false,
+		HealthCheckInterval:    metav1.Duration{Duration: defaultHealthCheckInterval},
+		ResourceDomain:         defaultResourceDomain,
+		PartitioningPolicy:     defaultPartitioningPolicy,
+		Allocator:              defaultAllocator,
+		AllocationSearchBudget: metav1.Duration{Duration: defaultAllocationSearchBudget},
+		HealthChecks:           newDefaultHealthChecksConfig(),
+		HealthHysteresis:       newDefaultHealthHysteresisConfig(),
+		Telemetry:              newDefaultTelemetryConfig(),
+		DeviceInjection:        defaultDeviceInjection,
+		CDISpecDir:             defaultCDISpecDir,
+		PodResources:           newDefaultPodResourcesConfig(),
+		DeviceDiscovery:        newDefaultDeviceDiscoveryConfig(),
+	}
+}
+
+// PartitioningPolicyFor returns the partitioning policy applied to the devices of the given architecture.
+func (c *Config) PartitioningPolicyFor(arch string) furiosa_device.PartitioningPolicy {
+	if policy, exist := c.ArchPartitioningPolicies[arch]; exist {
+		return policy
+	}
+
+	return c.PartitioningPolicy
+}
+
+// AllocatorFor returns the allocator of the devices exposed under the given resource name.
+func (c *Config) AllocatorFor(resourceName string) AllocatorType {
+	if allocator, exist := c.ResourceAllocators[resourceName]; exist {
+		return allocator
+	}
+
+	return c.Allocator
+}
+
+// ResourceNameFor returns ResourceNameConfig naming the resource of the devices of the arch partitioned with the policy.
+// ResourceNameConfig with the exact policy takes precedence over the one selecting every policy.
+func (c *Config) ResourceNameFor(arch string, policy furiosa_device.PartitioningPolicy) (ResourceNameConfig, bool) {
+	index := c.resourceNameIndex(arch, policy)
+	if index < 0 {
+		return ResourceNameConfig{}, false
+	}
+
+	return c.ResourceNames[index], true
+}
+
+// resourceNameIndex returns the index of ResourceNameConfig returned by ResourceNameFor, or -1 if there is none.
+func (c *Config) resourceNameIndex(arch string, policy furiosa_device.PartitioningPolicy) int {
+	matched := -1
+	for i, resourceName := range c.ResourceNames {
+		if !resourceName.selects(arch, policy) {
+			continue
+		}
+
+		if matched < 0 || resourceName.Policy != "" {
+			matched = i
+		}
+	}
+
+	return matched
+}
+
+// ResolveResourceName returns the domain and the name of the resource of the devices of the arch partitioned with the
+// policy. The resource is named after the arch unless ResourceNameConfig selects the arch and the policy.
+func (c *Config) ResolveResourceName(arch string, policy furiosa_device.PartitioningPolicy) (string, string) {
+	resourceName, exist := c.ResourceNameFor(arch, policy)
+	if !exist {
+		return c.ResourceDomain, PartitionedResourceName(strings.ToLower(arch), policy)
+	}
+
+	domain := c.ResourceDomain
+	if resourceName.Domain != "" {
+		domain = resourceName.Domain
+	}
+
+	// the policy is already distinguished by the name if the policy is given explicitly.
+	if resourceName.Policy != "" {
+		return domain, resourceName.Name
+	}
+
+	return domain, PartitionedResourceName(resourceName.Name, policy)
+}
+
+// PartitionedResourceName returns the base name for whole devices, and appends the number of cores per partition for
+// partitioned devices, e.g. "rngd" for NonePolicy and "rngd-2core" for DualCorePolicy.
+func PartitionedResourceName(baseName string, policy furiosa_device.PartitioningPolicy) string {
+	if policy == furiosa_device.NonePolicy {
+		return baseName
+	}
+
+	return fmt.Sprintf(partitionedResourceNameExp, baseName, policy.CoreSize())
+}
+
+// Parse decodes YAML or JSON bytes on top of the default values.
+// Unknown and duplicated fields are rejected.
+func Parse(raw []byte) (*Config, error) {
+	cfg := NewDefaultConfig()
+	// the version must be written explicitly so that an old file is never silently accepted by a new schema.
+	cfg.Version = ""
+
+	if err := yaml.UnmarshalStrict(raw, cfg); err != nil {
+		return nil, fmt.Errorf("couldn't parse configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LoadFromFile reads the configuration file located at the given path.
+func LoadFromFile(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read configuration file %s: %w", path, err)
+	}
+
+	cfg, err := Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Load builds Config from the defaults, the configuration file, environment variables and flags in order, and validates the result.
+// The configuration file is optional, the defaults are used when the path is empty.
+func Load(path string, lookupEnv func(string) (string, bool), fs *pflag.FlagSet) (*Config, error) {
+	cfg := NewDefaultConfig()
+	if path != "" {
+		loaded, err := LoadFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	if err := cfg.ApplyEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	if fs != nil {
+		if err := cfg.ApplyFlags(fs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
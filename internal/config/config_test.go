@@ -0,0 +1,603 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		description    string
+		raw            string
+		expectedResult *Config
+		expectError    bool
+	}{
+		{
+			description: "parse full yaml configuration",
+			raw: `
+version: v1
+debugMode: true
+healthCheckInterval: 10s
+resourceDomain: acme.com
+partitioningPolicy: dual-core
+allocator: bin-packing
+`,
+			expectedResult: &Config{
+				Version:                VersionV1,
+				DebugMode:              true,
+				HealthCheckInterval:    metav1.Duration{Duration: 10 * time.Second},
+				ResourceDomain:         "acme.com",
+				PartitioningPolicy:     furiosa_device.DualCorePolicy,
+				Allocator:              BinPackingAllocator,
+				AllocationSearchBudget: metav1.Duration{Duration: defaultAllocationSearchBudget},
+				HealthChecks:           newDefaultHealthChecksConfig(),
+				HealthHysteresis:       newDefaultHealthHysteresisConfig(),
+				Telemetry:              newDefaultTelemetryConfig(),
+				DeviceInjection:        defaultDeviceInjection,
+				CDISpecDir:             defaultCDISpecDir,
+				PodResources:           newDefaultPodResourcesConfig(),
+				DeviceDiscovery:        newDefaultDeviceDiscoveryConfig(),
+			},
+			expectError: false,
+		},
+		{
+			description: "parse partial json configuration on top of defaults",
+			raw:         `{"version": "v1", "debugMode": true}`,
+			expectedResult: &Config{
+				Version:                VersionV1,
+				DebugMode:              true,
+				HealthCheckInterval:    metav1.Duration{Duration: defaultHealthCheckInterval},
+				ResourceDomain:         defaultResourceDomain,
+				PartitioningPolicy:     defaultPartitioningPolicy,
+				Allocator:              defaultAllocator,
+				AllocationSearchBudget: metav1.Duration{Duration: defaultAllocationSearchBudget},
+				HealthChecks:           newDefaultHealthChecksConfig(),
+				HealthHysteresis:       newDefaultHealthHysteresisConfig(),
+				Telemetry:              newDefaultTelemetryConfig(),
+				DeviceInjection:        defaultDeviceInjection,
+				CDISpecDir:             defaultCDISpecDir,
+				PodResources:           newDefaultPodResourcesConfig(),
+				DeviceDiscovery:        newDefaultDeviceDiscoveryConfig(),
+			},
+			expectError: false,
+		},
+		{
+			description: "parse health checks on top of defaults",
+			raw: `
+version: v1
+healthChecks:
+  temperature:
+    enabled: true
+  throttling:
+    enabled: true
+    duration: 30s
+  pcieLink:
+    enabled: true
+    minLinkWidth: 8
+`,
+			expectedResult: &Config{
+				Version:                VersionV1,
+				HealthCheckInterval:    metav1.Duration{Duration: defaultHealthCheckInterval},
+				ResourceDomain:         defaultResourceDomain,
+				PartitioningPolicy:     defaultPartitioningPolicy,
+				Allocator:              defaultAllocator,
+				AllocationSearchBudget: metav1.Duration{Duration: defaultAllocationSearchBudget},
+				HealthChecks: HealthChecksConfig{
+					Temperature: TemperatureCheckConfig{Enabled: true, SocPeakThreshold: defaultSocPeakThreshold},
+					Throttling:  ThrottlingCheckConfig{Enabled: true, Duration: metav1.Duration{Duration: 30 * time.Second}},
+					PcieLink:    PcieLinkCheckConfig{Enabled: true, MinLinkWidth: 8},
+				},
+				HealthHysteresis: newDefaultHealthHysteresisConfig(),
+				Telemetry:        newDefaultTelemetryConfig(),
+				DeviceInjection:  defaultDeviceInjection,
+				CDISpecDir:       defaultCDISpecDir,
+				PodResources:     newDefaultPodResourcesConfig(),
+				DeviceDiscovery:  newDefaultDeviceDiscoveryConfig(),
+			},
+			expectError: false,
+		},
+		{
+			description:    "reject unknown field",
+			raw:            "version: v1\nhealthCheckPeriod: 10s\n",
+			expectedResult: nil,
+			expectError:    true,
+		},
+		{
+			description:    "reject malformed duration",
+			raw:            "version: v1\nhealthCheckInterval: ten seconds\n",
+			expectedResult: nil,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			actualResult, actualErr := Parse([]byte(tc.raw))
+			if tc.expectError {
+				assert.Error(t, actualErr)
+			} else {
+				assert.NoError(t, actualErr)
+			}
+
+			assert.Equal(t, tc.expectedResult, actualResult)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		description string
+		mutate      func(c *Config)
+		expectError bool
+	}{
+		{
+			description: "default configuration is valid",
+			mutate:      func(c *Config) {},
+			expectError: false,
+		},
+		{
+			description: "missing version",
+			mutate:      func(c *Config) { c.Version = "" },
+			expectError: true,
+		},
+		{
+			description: "unsupported version",
+			mutate:      func(c *Config) { c.Version = "v2" },
+			expectError: true,
+		},
+		{
+			description: "zero health check interval",
+			mutate:      func(c *Config) { c.HealthCheckInterval.Duration = 0 },
+			expectError: true,
+		},
+		{
+			description: "invalid resource domain",
+			mutate:      func(c *Config) { c.ResourceDomain = "Furiosa_AI" },
+			expectError: true,
+		},
+		{
+			description: "zero temperature threshold",
+			mutate: func(c *Config) {
+				c.HealthChecks.Temperature = TemperatureCheckConfig{Enabled: true, SocPeakThreshold: 0}
+			},
+			expectError: true,
+		},
+		{
+			description: "negative throttling duration",
+			mutate:      func(c *Config) { c.HealthChecks.Throttling.Duration.Duration = -time.Second },
+			expectError: true,
+		},
+		{
+			description: "negative pcie link speed",
+			mutate:      func(c *Config) { c.HealthChecks.PcieLink.MinLinkSpeed = -1 },
+			expectError: true,
+		},
+		{
+			description: "zero failure threshold",
+			mutate:      func(c *Config) { c.HealthHysteresis.FailureThreshold = 0 },
+			expectError: true,
+		},
+		{
+			description: "zero success threshold",
+			mutate:      func(c *Config) { c.HealthHysteresis.SuccessThreshold = 0 },
+			expectError: true,
+		},
+		{
+			description: "quarantine without window",
+			mutate: func(c *Config) {
+				c.HealthHysteresis.Quarantine = QuarantineConfig{FlapThreshold: 3, Duration: metav1.Duration{Duration: time.Minute}}
+			},
+			expectError: true,
+		},
+		{
+			description: "quarantine enabled",
+			mutate:      func(c *Config) { c.HealthHysteresis.Quarantine.FlapThreshold = 3 },
+			expectError: false,
+		},
+		{
+			description: "metrics address without port",
+			mutate:      func(c *Config) { c.MetricsAddress = "localhost" },
+			expectError: true,
+		},
+		{
+			description: "metrics address",
+			mutate:      func(c *Config) { c.MetricsAddress = ":9400" },
+			expectError: false,
+		},
+		{
+			description: "telemetry without metrics address",
+			mutate:      func(c *Config) { c.Telemetry.Enabled = true },
+			expectError: true,
+		},
+		{
+			description: "telemetry with too short utilization interval",
+			mutate: func(c *Config) {
+				c.MetricsAddress = ":9400"
+				c.Telemetry = TelemetryConfig{Enabled: true, UtilizationInterval: metav1.Duration{Duration: time.Microsecond}}
+			},
+			expectError: true,
+		},
+		{
+			description: "telemetry",
+			mutate: func(c *Config) {
+				c.MetricsAddress = ":9400"
+				c.Telemetry.Enabled = true
+			},
+			expectError: false,
+		},
+		{
+			description: "unknown device injection mode",
+			mutate:      func(c *Config) { c.DeviceInjection = "oci" },
+			expectError: true,
+		},
+		{
+			description: "cdi device injection with relative spec dir",
+			mutate: func(c *Config) {
+				c.DeviceInjection = CDIDeviceInjection
+				c.CDISpecDir = "cdi"
+			},
+			expectError: true,
+		},
+		{
+			description: "both device injection",
+			mutate:      func(c *Config) { c.DeviceInjection = BothDeviceInjection },
+			expectError: false,
+		},
+		{
+			description: "pod resources without metrics address",
+			mutate:      func(c *Config) { c.PodResources.Enabled = true },
+			expectError: true,
+		},
+		{
+			description: "pod resources with relative socket path",
+			mutate: func(c *Config) {
+				c.MetricsAddress = ":9400"
+				c.PodResources = PodResourcesConfig{Enabled: true, SocketPath: "kubelet.sock"}
+			},
+			expectError: true,
+		},
+		{
+			description: "pod resources",
+			mutate: func(c *Config) {
+				c.MetricsAddress = ":9400"
+				c.PodResources.Enabled = true
+			},
+			expectError: false,
+		},
+		{
+			description: "resource names with aliases",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{
+					{Archs: []string{"rngd", "rngd-max"}, Name: "npu"},
+					{Archs: []string{"rngd"}, Policy: furiosa_device.QuadCorePolicy, Domain: "acme.com", Name: "npu-large"},
+				}
+			},
+			expectError: false,
+		},
+		{
+			description: "resource name without archs",
+			mutate:      func(c *Config) { c.ResourceNames = []ResourceNameConfig{{Name: "npu"}} },
+			expectError: true,
+		},
+		{
+			description: "resource name for an unknown arch",
+			mutate:      func(c *Config) { c.ResourceNames = []ResourceNameConfig{{Archs: []string{"warboy"}, Name: "npu"}} },
+			expectError: true,
+		},
+		{
+			description: "invalid resource name",
+			mutate:      func(c *Config) { c.ResourceNames = []ResourceNameConfig{{Archs: []string{"rngd"}, Name: "NPU_Large"}} },
+			expectError: true,
+		},
+		{
+			description: "invalid resource name domain",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{{Archs: []string{"rngd"}, Domain: "acme..com", Name: "npu"}}
+			},
+			expectError: true,
+		},
+		{
+			description: "arch and policy selected by multiple resource names",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{
+					{Archs: []string{"rngd"}, Name: "npu"},
+					{Archs: []string{"rngd-max", "rngd"}, Name: "npu-any"},
+				}
+			},
+			expectError: true,
+		},
+		{
+			description: "resource name of an arch shared by different policies",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{
+					{Archs: []string{"rngd"}, Policy: furiosa_device.NonePolicy, Name: "npu"},
+					{Archs: []string{"rngd"}, Policy: furiosa_device.DualCorePolicy, Name: "npu"},
+				}
+			},
+			expectError: true,
+		},
+		{
+			description: "resource name of different archs shared by different policies",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{
+					{Archs: []string{"rngd"}, Name: "npu"},
+					{Archs: []string{"rngd-max"}, Policy: furiosa_device.QuadCorePolicy, Name: "npu"},
+				}
+			},
+			expectError: true,
+		},
+		{
+			description: "resource name same as the name derived from an arch with another policy",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{{Archs: []string{"rngd-max"}, Policy: furiosa_device.DualCorePolicy, Name: "rngd"}}
+			},
+			expectError: true,
+		},
+		{
+			description: "resource name same as the name derived from an arch with the same policy",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{{Archs: []string{"rngd-max"}, Policy: furiosa_device.NonePolicy, Name: "rngd"}}
+			},
+			expectError: false,
+		},
+		{
+			description: "resource name shared by different policies in different domains",
+			mutate: func(c *Config) {
+				c.ResourceNames = []ResourceNameConfig{{Archs: []string{"rngd-max"}, Policy: furiosa_device.DualCorePolicy, Domain: "acme.com", Name: "rngd"}}
+			},
+			expectError: false,
+		},
+		{
+			description: "fallback resource name of unknown archs same as the name derived from an arch",
+			mutate:      func(c *Config) { c.UnknownArch.ResourceName = "rngd" },
+			expectError: false,
+		},
+		{
+			description: "fallback resource name of unknown archs shared by different policies",
+			mutate:      func(c *Config) { c.UnknownArch.ResourceName = "rngd-s-1core" },
+			expectError: true,
+		},
+		{
+			description: "fallback resource name of unknown archs",
+			mutate:      func(c *Config) { c.UnknownArch.ResourceName = "npu-unknown" },
+			expectError: false,
+		},
+		{
+			description: "invalid fallback resource name of unknown archs",
+			mutate:      func(c *Config) { c.UnknownArch.ResourceName = "npu/unknown" },
+			expectError: true,
+		},
+		{
+			description: "label node with unknown archs without node name",
+			mutate:      func(c *Config) { c.UnknownArch.LabelNode = true },
+			expectError: true,
+		},
+		{
+			description: "static and templated container envs",
+			mutate: func(c *Config) {
+				c.ContainerEnvs = []ContainerEnv{
+					{Name: "NPU_QUEUE", Value: "inference"},
+					{Name: "NPU_DEVICES", Value: `{{ join "," .UUIDs }}`, Resources: []string{"furiosa.ai/rngd"}},
+				}
+			},
+			expectError: false,
+		},
+		{
+			description: "invalid container env name",
+			mutate:      func(c *Config) { c.ContainerEnvs = []ContainerEnv{{Name: "NPU QUEUE", Value: "inference"}} },
+			expectError: true,
+		},
+		{
+			description: "malformed container env template",
+			mutate:      func(c *Config) { c.ContainerEnvs = []ContainerEnv{{Name: "NPU_DEVICES", Value: "{{ .UUIDs"}} },
+			expectError: true,
+		},
+		{
+			description: "container env for an invalid resource name",
+			mutate: func(c *Config) {
+				c.ContainerEnvs = []ContainerEnv{{Name: "NPU_QUEUE", Value: "inference", Resources: []string{"furiosa.ai/rngd/2core"}}}
+			},
+			expectError: true,
+		},
+		{
+			description: "device discovery only at startup",
+			mutate:      func(c *Config) { c.DeviceDiscovery = DeviceDiscoveryConfig{} },
+			expectError: false,
+		},
+		{
+			description: "device discovery with negative interval",
+			mutate:      func(c *Config) { c.DeviceDiscovery.Interval = metav1.Duration{Duration: -time.Second} },
+			expectError: true,
+		},
+		{
+			description: "device discovery watching relative path",
+			mutate:      func(c *Config) { c.DeviceDiscovery.WatchPaths = []string{"dev/rngd"} },
+			expectError: true,
+		},
+		{
+			description: "unknown partitioning policy",
+			mutate:      func(c *Config) { c.PartitioningPolicy = "triple-core" },
+			expectError: true,
+		},
+		{
+			description: "partitioning policy override for a known arch",
+			mutate: func(c *Config) {
+				c.ArchPartitioningPolicies = map[string]furiosa_device.PartitioningPolicy{"rngd": furiosa_device.QuadCorePolicy}
+			},
+			expectError: false,
+		},
+		{
+			description: "partitioning policy override for an unknown arch",
+			mutate: func(c *Config) {
+				c.ArchPartitioningPolicies = map[string]furiosa_device.PartitioningPolicy{"warboy": furiosa_device.SingleCorePolicy}
+			},
+			expectError: true,
+		},
+		{
+			description: "invalid partitioning policy override",
+			mutate: func(c *Config) {
+				c.ArchPartitioningPolicies = map[string]furiosa_device.PartitioningPolicy{"rngd": "octa-core"}
+			},
+			expectError: true,
+		},
+		{
+			description: "valid partitioning groups",
+			mutate: func(c *Config) {
+				c.PartitioningGroups = []PartitioningGroup{
+					{Policy: furiosa_device.DualCorePolicy, Devices: []string{"0", "0000:51:00.0"}},
+					{Policy: furiosa_device.SingleCorePolicy, Devices: []string{"A76AAD68-6855-40B1-9E86-D080852D1C87"}},
+				}
+			},
+			expectError: false,
+		},
+		{
+			description: "partitioning group without devices",
+			mutate: func(c *Config) {
+				c.PartitioningGroups = []PartitioningGroup{{Policy: furiosa_device.DualCorePolicy}}
+			},
+			expectError: true,
+		},
+		{
+			description: "device selected by multiple partitioning groups",
+			mutate: func(c *Config) {
+				c.PartitioningGroups = []PartitioningGroup{
+					{Policy: furiosa_device.DualCorePolicy, Devices: []string{"0"}},
+					{Policy: furiosa_device.SingleCorePolicy, Devices: []string{"0"}},
+				}
+			},
+			expectError: true,
+		},
+		{
+			description: "blocked devices with node annotation",
+			mutate: func(c *Config) {
+				c.BlockedDevices = []string{"0", "TEST0236FH505KRE1"}
+				c.BlockedDevicesNodeAnnotation = "furiosa.ai/blocked-devices"
+				c.NodeName = "node0"
+			},
+			expectError: false,
+		},
+		{
+			description: "blocked devices node annotation without node name",
+			mutate:      func(c *Config) { c.BlockedDevicesNodeAnnotation = "furiosa.ai/blocked-devices" },
+			expectError: true,
+		},
+		{
+			description: "invalid blocked devices node annotation",
+			mutate: func(c *Config) {
+				c.BlockedDevicesNodeAnnotation = "furiosa.ai/blocked devices"
+				c.NodeName = "node0"
+			},
+			expectError: true,
+		},
+		{
+			description: "unknown allocator",
+			mutate:      func(c *Config) { c.Allocator = "random" },
+			expectError: true,
+		},
+		{
+			description: "allocators per resource",
+			mutate: func(c *Config) {
+				c.ResourceAllocators = map[string]AllocatorType{"furiosa.ai/rngd": SpreadAllocator, "acme.com/npu-2core": SingleNUMAAllocator}
+			},
+			expectError: false,
+		},
+		{
+			description: "unknown allocator of a resource",
+			mutate:      func(c *Config) { c.ResourceAllocators = map[string]AllocatorType{"furiosa.ai/rngd": "random"} },
+			expectError: true,
+		},
+		{
+			description: "unlimited allocation search",
+			mutate:      func(c *Config) { c.AllocationSearchBudget = metav1.Duration{} },
+			expectError: false,
+		},
+		{
+			description: "negative allocation search budget",
+			mutate:      func(c *Config) { c.AllocationSearchBudget = metav1.Duration{Duration: -time.Millisecond} },
+			expectError: true,
+		},
+		{
+			description: "allocator of a resource name without domain",
+			mutate:      func(c *Config) { c.ResourceAllocators = map[string]AllocatorType{"rngd": SpreadAllocator} },
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := NewDefaultConfig()
+			tc.mutate(cfg)
+
+			if tc.expectError {
+				assert.Error(t, cfg.Validate())
+			} else {
+				assert.NoError(t, cfg.Validate())
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("version: v1\nresourceDomain: acme.com\nallocator: bin-packing\n"), 0644))
+
+	env := map[string]string{
+		"FURIOSA_DEVICE_PLUGIN_ALLOCATOR":             "score-based",
+		"FURIOSA_DEVICE_PLUGIN_HEALTH_CHECK_INTERVAL": "30s",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		value, exist := env[key]
+		return value, exist
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--healthCheckInterval=1m", "--debugMode"}))
+
+	actual, err := Load(path, lookupEnv, fs)
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		Version:                VersionV1,
+		DebugMode:              true,
+		HealthCheckInterval:    metav1.Duration{Duration: time.Minute},
+		ResourceDomain:         "acme.com",
+		PartitioningPolicy:     defaultPartitioningPolicy,
+		Allocator:              ScoreBasedAllocator,
+		AllocationSearchBudget: metav1.Duration{Duration: defaultAllocationSearchBudget},
+		HealthChecks:           newDefaultHealthChecksConfig(),
+		HealthHysteresis:       newDefaultHealthHysteresisConfig(),
+		Telemetry:              newDefaultTelemetryConfig(),
+		DeviceInjection:        defaultDeviceInjection,
+		CDISpecDir:             defaultCDISpecDir,
+		PodResources:           newDefaultPodResourcesConfig(),
+		DeviceDiscovery:        newDefaultDeviceDiscoveryConfig(),
+	}, actual)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"), lookupEnv, nil)
+	assert.Error(t, err)
+}
+
+func TestPartitioningPolicyFor(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.PartitioningPolicy = furiosa_device.SingleCorePolicy
+	cfg.ArchPartitioningPolicies = map[string]furiosa_device.PartitioningPolicy{"rngd": furiosa_device.DualCorePolicy}
+
+	assert.Equal(t, furiosa_device.DualCorePolicy, cfg.PartitioningPolicyFor("rngd"))
+	assert.Equal(t, furiosa_device.SingleCorePolicy, cfg.PartitioningPolicyFor("rngd-s"))
+}
+
+func TestAllocatorFor(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.Allocator = BinPackingAllocator
+	cfg.ResourceAllocators = map[string]AllocatorType{"furiosa.ai/rngd": SpreadAllocator}
+
+	assert.Equal(t, SpreadAllocator, cfg.AllocatorFor("furiosa.ai/rngd"))
+	assert.Equal(t, BinPackingAllocator, cfg.AllocatorFor("furiosa.ai/rngd-2core"))
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ContainerEnv is an environment variable injected into the containers allocated the devices of the selected resources.
+type ContainerEnv struct {
+	Name string `json:"name"`
+	// Value is a text/template rendered with the allocated devices at each Allocate, a value without actions is static.
+	Value string `json:"value"`
+	// Resources selects the resources by the full resource name, e.g. "furiosa.ai/rngd". Every resource is selected if empty.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// containerEnvFuncs are the functions available in the templates of ContainerEnv.
+var containerEnvFuncs = template.FuncMap{
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+}
+
+// Template parses Value of ContainerEnv, a missing key of the data is an error when the template is executed.
+func (e ContainerEnv) Template() (*template.Template, error) {
+	return template.New(e.Name).Funcs(containerEnvFuncs).Option("missingkey=error").Parse(e.Value)
+}
+
+// Selects returns whether the environment variable is injected for the resource.
+func (e ContainerEnv) Selects(resourceName string) bool {
+	if len(e.Resources) == 0 {
+		return true
+	}
+
+	for _, resource := range e.Resources {
+		if resource == resourceName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateContainerEnvs(fldPath *field.Path, envs []ContainerEnv) field.ErrorList {
+	var errs field.ErrorList
+
+	for i, env := range envs {
+		envPath := fldPath.Index(i)
+		for _, msg := range validation.IsEnvVarName(env.Name) {
+			errs = append(errs, field.Invalid(envPath.Child("name"), env.Name, msg))
+		}
+
+		if _, err := env.Template(); err != nil {
+			errs = append(errs, field.Invalid(envPath.Child("value"), env.Value, err.Error()))
+		}
+
+		for j, resource := range env.Resources {
+			for _, msg := range validation.IsQualifiedName(resource) {
+				errs = append(errs, field.Invalid(envPath.Child("resources").Index(j), resource, msg))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	defaultSocPeakThreshold   = 95.0
+	defaultThrottlingDuration = time.Minute
+
+	defaultFailureThreshold   = 1
+	defaultSuccessThreshold   = 1
+	defaultFlapWindow         = 10 * time.Minute
+	defaultQuarantineDuration = 30 * time.Minute
+)
+
+// HealthChecksConfig configures the health checks performed in addition to the liveness of the devices.
+// Every check is disabled by default.
+type HealthChecksConfig struct {
+	Temperature TemperatureCheckConfig `json:"temperature"`
+	Throttling  ThrottlingCheckConfig  `json:"throttling"`
+	PcieLink    PcieLinkCheckConfig    `json:"pcieLink"`
+	CoreStatus  CoreStatusCheckConfig  `json:"coreStatus"`
+}
+
+// TemperatureCheckConfig reports a card as unhealthy when the peak SoC temperature exceeds the threshold in Celsius.
+type TemperatureCheckConfig struct {
+	Enabled          bool    `json:"enabled"`
+	SocPeakThreshold float64 `json:"socPeakThreshold"`
+}
+
+// ThrottlingCheckConfig reports a card as unhealthy when it keeps throttling for longer than Duration.
+// Idle throttling is ignored.
+type ThrottlingCheckConfig struct {
+	Enabled  bool            `json:"enabled"`
+	Duration metav1.Duration `json:"duration"`
+}
+
+// PcieLinkCheckConfig reports a card as unhealthy when the PCIe link is trained below the given width and speed in GT/s.
+// Zero means the maximum capability of the link.
+type PcieLinkCheckConfig struct {
+	Enabled      bool    `json:"enabled"`
+	MinLinkWidth uint32  `json:"minLinkWidth,omitempty"`
+	MinLinkSpeed float64 `json:"minLinkSpeed,omitempty"`
+}
+
+// CoreStatusCheckConfig reports the partitions containing PE cores in an unexpected state as unhealthy.
+type CoreStatusCheckConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// HealthHysteresisConfig damps transient changes of the device health.
+type HealthHysteresisConfig struct {
+	// FailureThreshold is the number of consecutive failed checks to report a healthy device as unhealthy.
+	FailureThreshold int `json:"failureThreshold"`
+	// SuccessThreshold is the number of consecutive successful checks to report an unhealthy device as healthy.
+	SuccessThreshold int `json:"successThreshold"`
+	// Quarantine keeps a flapping device unhealthy for a while.
+	Quarantine QuarantineConfig `json:"quarantine"`
+}
+
+// QuarantineConfig keeps a device unhealthy for Duration once it becomes unhealthy FlapThreshold times within Window.
+// Quarantine is disabled when FlapThreshold is zero.
+type QuarantineConfig struct {
+	FlapThreshold int             `json:"flapThreshold"`
+	Window        metav1.Duration `json:"window"`
+	Duration      metav1.Duration `json:"duration"`
+}
+
+func newDefaultHealthHysteresisConfig() HealthHysteresisConfig {
+	return HealthHysteresisConfig{
+		FailureThreshold: defaultFailureThreshold,
+		SuccessThreshold: defaultSuccessThreshold,
+		Quarantine: QuarantineConfig{
+			Window:   metav1.Duration{Duration: defaultFlapWindow},
+			Duration: metav1.Duration{Duration: defaultQuarantineDuration},
+		},
+	}
+}
+
+func newDefaultHealthChecksConfig() HealthChecksConfig {
+	return HealthChecksConfig{
+		Temperature: TemperatureCheckConfig{SocPeakThreshold: defaultSocPeakThreshold},
+		Throttling:  ThrottlingCheckConfig{Duration: metav1.Duration{Duration: defaultThrottlingDuration}},
+	}
+}
+
+func validateHealthChecks(fldPath *field.Path, healthChecks HealthChecksConfig) field.ErrorList {
+	var errs field.ErrorList
+
+	if healthChecks.Temperature.SocPeakThreshold <= 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("temperature", "socPeakThreshold"), healthChecks.Temperature.SocPeakThreshold, "must be greater than zero"))
+	}
+
+	if healthChecks.Throttling.Duration.Duration < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("throttling", "duration"), healthChecks.Throttling.Duration.Duration.String(), "must not be negative"))
+	}
+
+	if healthChecks.PcieLink.MinLinkSpeed < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("pcieLink", "minLinkSpeed"), healthChecks.PcieLink.MinLinkSpeed, "must not be negative"))
+	}
+
+	return errs
+}
+
+func validateHealthHysteresis(fldPath *field.Path, hysteresis HealthHysteresisConfig) field.ErrorList {
+	var errs field.ErrorList
+
+	if hysteresis.FailureThreshold < 1 {
+		errs = append(errs, field.Invalid(fldPath.Child("failureThreshold"), hysteresis.FailureThreshold, "must be greater than zero"))
+	}
+
+	if hysteresis.SuccessThreshold < 1 {
+		errs = append(errs, field.Invalid(fldPath.Child("successThreshold"), hysteresis.SuccessThreshold, "must be greater than zero"))
+	}
+
+	quarantinePath := fldPath.Child("quarantine")
+	if hysteresis.Quarantine.FlapThreshold < 0 {
+		errs = append(errs, field.Invalid(quarantinePath.Child("flapThreshold"), hysteresis.Quarantine.FlapThreshold, "must not be negative"))
+	}
+
+	if hysteresis.Quarantine.FlapThreshold > 0 {
+		if hysteresis.Quarantine.Window.Duration <= 0 {
+			errs = append(errs, field.Invalid(quarantinePath.Child("window"), hysteresis.Quarantine.Window.Duration.String(), "must be greater than zero"))
+		}
+
+		if hysteresis.Quarantine.Duration.Duration <= 0 {
+			errs = append(errs, field.Invalid(quarantinePath.Child("duration"), hysteresis.Quarantine.Duration.Duration.String(), "must be greater than zero"))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/spf13/pflag"
+)
+
+const (
+	envPrefix = "FURIOSA_DEVICE_PLUGIN_"
+
+	DebugModeFlag           = "debugMode"
+	HealthCheckIntervalFlag = "healthCheckInterval"
+	ResourceDomainFlag      = "resourceDomain"
+	PartitioningPolicyFlag  = "partitioningPolicy"
+	AllocatorFlag           = "allocator"
+	NodeNameFlag            = "nodeName"
+	MetricsAddressFlag      = "metricsAddress"
+	DeviceInjectionFlag     = "deviceInjection"
+
+	// NODE_NAME is the conventional variable injected by the downward api, so it doesn't have the prefix.
+	nodeNameEnv = "NODE_NAME"
+)
+
+// override describes a single field of Config that can be overridden by an environment variable and a command line flag.
+type override struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+var overrides = []override{
+	{
+		flag:   DebugModeFlag,
+		env:    envPrefix + "DEBUG_MODE",
+		usage:  "enable debug logging",
+		isBool: true,
+		set: func(c *Config, value string) error {
+			debugMode, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			c.DebugMode = debugMode
+			return nil
+		},
+	},
+	{
+		flag:  HealthCheckIntervalFlag,
+		env:   envPrefix + "HEALTH_CHECK_INTERVAL",
+		usage: "interval of the device health check, e.g. 5s",
+		set: func(c *Config, value string) error {
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			c.HealthCheckInterval.Duration = interval
+			return nil
+		},
+	},
+	{
+		flag:  ResourceDomainFlag,
+		env:   envPrefix + "RESOURCE_DOMAIN",
+		usage: "domain of the extended resource names",
+		set: func(c *Config, value string) error {
+			c.ResourceDomain = value
+			return nil
+		},
+	},
+	{
+		flag:  PartitioningPolicyFlag,
+		env:   envPrefix + "PARTITIONING_POLICY",
+		usage: "partitioning policy of the devices, one of none, single-core, dual-core and quad-core",
+		set: func(c *Config, value string) error {
+			c.PartitioningPolicy = furiosa_device.PartitioningPolicy(value)
+			return nil
+		},
+	},
+	{
+		flag:  AllocatorFlag,
+		env:   envPrefix + "ALLOCATOR",
+		usage: "preferred allocation strategy, one of score-based, bin-packing, branch-and-bound, single-numa and spread",
+		set: func(c *Config, value string) error {
+			c.Allocator = AllocatorType(value)
+			return nil
+		},
+	},
+	{
+		flag:  NodeNameFlag,
+		env:   nodeNameEnv,
+		usage: "name of the node running the device plugin",
+		set: func(c *Config, value string) error {
+			c.NodeName = value
+			return nil
+		},
+	},
+	{
+		flag:  MetricsAddressFlag,
+		env:   envPrefix + "METRICS_ADDRESS",
+		usage: "address serving the metrics in Prometheus text format, e.g. :9400, disabled if empty",
+		set: func(c *Config, value string) error {
+			c.MetricsAddress = value
+			return nil
+		},
+	},
+	{
+		flag:  DeviceInjectionFlag,
+		env:   envPrefix + "DEVICE_INJECTION",
+		usage: "how the devices are injected into the containers, one of legacy, cdi and both",
+		set: func(c *Config, value string) error {
+			c.DeviceInjection = DeviceInjectionMode(value)
+			return nil
+		},
+	},
+}
+
+// AddFlags registers the command line flags that override Config fields.
+func AddFlags(fs *pflag.FlagSet) {
+	for _, o := range overrides {
+		if o.isBool {
+			fs.Bool(o.flag, false, o.usage)
+		} else {
+			fs.String(o.flag, "", o.usage)
+		}
+	}
+}
+
+// ApplyEnv overrides Config fields with environment variables found by lookupEnv.
+func (c *Config) ApplyEnv(lookupEnv func(string) (string, bool)) error {
+	for _, o := range overrides {
+		value, exist := lookupEnv(o.env)
+		if !exist {
+			continue
+		}
+
+		if err := o.set(c, value); err != nil {
+			return fmt.Errorf("couldn't apply environment variable %s=%q: %w", o.env, value, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyFlags overrides Config fields with the command line flags explicitly set by the user.
+func (c *Config) ApplyFlags(fs *pflag.FlagSet) error {
+	for _, o := range overrides {
+		if !fs.Changed(o.flag) {
+			continue
+		}
+
+		value := fs.Lookup(o.flag).Value.String()
+		if err := o.set(c, value); err != nil {
+			return fmt.Errorf("couldn't apply flag --%s=%q: %w", o.flag, value, err)
+		}
+	}
+
+	return nil
+}
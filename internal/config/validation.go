@@ -0,0 +1,349 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	supportedArchs = []string{smi.ArchRngd.ToString(), smi.ArchRngdMax.ToString(), smi.ArchRngdS.ToString()}
+
+	supportedPartitioningPolicies = []string{
+		string(furiosa_device.NonePolicy),
+		string(furiosa_device.SingleCorePolicy),
+		string(furiosa_device.DualCorePolicy),
+		string(furiosa_device.QuadCorePolicy),
+	}
+
+	supportedAllocators = []string{
+		string(ScoreBasedAllocator),
+		string(BinPackingAllocator),
+		string(BranchAndBoundAllocator),
+		string(SingleNUMAAllocator),
+		string(SpreadAllocator),
+	}
+
+	supportedDeviceInjectionModes = []string{
+		string(LegacyDeviceInjection),
+		string(CDIDeviceInjection),
+		string(BothDeviceInjection),
+	}
+)
+
+// Validate checks every field of Config and returns all violations at once.
+func (c *Config) Validate() error {
+	var errs field.ErrorList
+
+	if c.Version != VersionV1 {
+		errs = append(errs, field.NotSupported(field.NewPath("version"), c.Version, []string{VersionV1}))
+	}
+
+	if c.HealthCheckInterval.Duration <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("healthCheckInterval"), c.HealthCheckInterval.Duration.String(), "must be greater than zero"))
+	}
+
+	for _, msg := range validation.IsDNS1123Subdomain(c.ResourceDomain) {
+		errs = append(errs, field.Invalid(field.NewPath("resourceDomain"), c.ResourceDomain, msg))
+	}
+
+	errs = append(errs, validatePartitioningPolicy(field.NewPath("partitioningPolicy"), c.PartitioningPolicy)...)
+	for arch, policy := range c.ArchPartitioningPolicies {
+		fldPath := field.NewPath("archPartitioningPolicies").Key(arch)
+		errs = append(errs, validateArch(fldPath, arch)...)
+		errs = append(errs, validatePartitioningPolicy(fldPath, policy)...)
+	}
+
+	errs = append(errs, validatePartitioningGroups(field.NewPath("partitioningGroups"), c.PartitioningGroups)...)
+	errs = append(errs, validateAllocator(field.NewPath("allocator"), c.Allocator)...)
+	for resourceName, allocator := range c.ResourceAllocators {
+		fldPath := field.NewPath("resourceAllocators").Key(resourceName)
+		errs = append(errs, validateFullResourceName(fldPath, resourceName)...)
+		errs = append(errs, validateAllocator(fldPath, allocator)...)
+	}
+
+	if c.AllocationSearchBudget.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("allocationSearchBudget"), c.AllocationSearchBudget.Duration.String(), "must not be negative"))
+	}
+
+	errs = append(errs, validateResourceNames(field.NewPath("resourceNames"), c.ResourceNames)...)
+	errs = append(errs, validateResourceNameConflicts(c)...)
+
+	if c.UnknownArch.ResourceName != "" {
+		for _, msg := range apivalidation.NameIsDNSSubdomain(c.UnknownArch.ResourceName, false) {
+			errs = append(errs, field.Invalid(field.NewPath("unknownArch", "resourceName"), c.UnknownArch.ResourceName, msg))
+		}
+	}
+
+	if c.UnknownArch.LabelNode && c.NodeName == "" {
+		errs = append(errs, field.Required(field.NewPath("nodeName"), "node name is required to label the node with unknown architectures"))
+	}
+
+	for i, selector := range c.BlockedDevices {
+		if selector == "" {
+			errs = append(errs, field.Required(field.NewPath("blockedDevices").Index(i), "device selector must not be empty"))
+		}
+	}
+
+	if c.BlockedDevicesNodeAnnotation != "" {
+		for _, msg := range validation.IsQualifiedName(c.BlockedDevicesNodeAnnotation) {
+			errs = append(errs, field.Invalid(field.NewPath("blockedDevicesNodeAnnotation"), c.BlockedDevicesNodeAnnotation, msg))
+		}
+
+		if c.NodeName == "" {
+			errs = append(errs, field.Required(field.NewPath("nodeName"), "node name is required to read blockedDevicesNodeAnnotation"))
+		}
+	}
+
+	errs = append(errs, validateHealthChecks(field.NewPath("healthChecks"), c.HealthChecks)...)
+	errs = append(errs, validateHealthHysteresis(field.NewPath("healthHysteresis"), c.HealthHysteresis)...)
+
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metricsAddress"), c.MetricsAddress, err.Error()))
+		}
+	}
+
+	if c.Telemetry.Enabled {
+		if c.MetricsAddress == "" {
+			errs = append(errs, field.Required(field.NewPath("metricsAddress"), "metrics address is required to export telemetry"))
+		}
+
+		if c.Telemetry.UtilizationInterval.Duration < time.Millisecond {
+			errs = append(errs, field.Invalid(field.NewPath("telemetry", "utilizationInterval"), c.Telemetry.UtilizationInterval.Duration.String(), "must be at least 1ms"))
+		}
+	}
+
+	errs = append(errs, validateDeviceInjection(field.NewPath("deviceInjection"), c.DeviceInjection)...)
+	if c.DeviceInjection.UsesCDI() && !filepath.IsAbs(c.CDISpecDir) {
+		errs = append(errs, field.Invalid(field.NewPath("cdiSpecDir"), c.CDISpecDir, "must be an absolute path"))
+	}
+
+	if c.PodResources.Enabled {
+		if c.MetricsAddress == "" {
+			errs = append(errs, field.Required(field.NewPath("metricsAddress"), "metrics address is required to serve pod resources"))
+		}
+
+		if !filepath.IsAbs(c.PodResources.SocketPath) {
+			errs = append(errs, field.Invalid(field.NewPath("podResources", "socketPath"), c.PodResources.SocketPath, "must be an absolute path"))
+		}
+	}
+
+	errs = append(errs, validateContainerEnvs(field.NewPath("containerEnvs"), c.ContainerEnvs)...)
+
+	if c.DeviceDiscovery.Interval.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("deviceDiscovery", "interval"), c.DeviceDiscovery.Interval.Duration.String(), "must not be negative"))
+	}
+
+	for i, watchPath := range c.DeviceDiscovery.WatchPaths {
+		if !filepath.IsAbs(watchPath) {
+			errs = append(errs, field.Invalid(field.NewPath("deviceDiscovery", "watchPaths").Index(i), watchPath, "must be an absolute path"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errs.ToAggregate())
+	}
+
+	return nil
+}
+
+func validateArch(fldPath *field.Path, arch string) field.ErrorList {
+	for _, supported := range supportedArchs {
+		if arch == supported {
+			return nil
+		}
+	}
+
+	return field.ErrorList{field.NotSupported(fldPath, arch, supportedArchs)}
+}
+
+func validatePartitioningPolicy(fldPath *field.Path, policy furiosa_device.PartitioningPolicy) field.ErrorList {
+	for _, supported := range supportedPartitioningPolicies {
+		if string(policy) == supported {
+			return nil
+		}
+	}
+
+	return field.ErrorList{field.NotSupported(fldPath, policy, supportedPartitioningPolicies)}
+}
+
+func validatePartitioningGroups(fldPath *field.Path, groups []PartitioningGroup) field.ErrorList {
+	var errs field.ErrorList
+
+	selected := make(map[string]struct{})
+	for i, group := range groups {
+		groupPath := fldPath.Index(i)
+		errs = append(errs, validatePartitioningPolicy(groupPath.Child("policy"), group.Policy)...)
+
+		if len(group.Devices) == 0 {
+			errs = append(errs, field.Required(groupPath.Child("devices"), "at least one device must be selected"))
+		}
+
+		for j, selector := range group.Devices {
+			if selector == "" {
+				errs = append(errs, field.Required(groupPath.Child("devices").Index(j), "device selector must not be empty"))
+				continue
+			}
+
+			if _, exist := selected[selector]; exist {
+				errs = append(errs, field.Duplicate(groupPath.Child("devices").Index(j), selector))
+				continue
+			}
+			selected[selector] = struct{}{}
+		}
+	}
+
+	return errs
+}
+
+// validateResourceNameConflicts rejects a resource name given to the devices partitioned with different policies, since
+// the devices of a resource must be interchangeable. Every arch may be partitioned with every policy by the partitioning
+// groups, so the names are resolved for every pair of them as the device manager does.
+func validateResourceNameConflicts(c *Config) field.ErrorList {
+	type origin struct {
+		policy furiosa_device.PartitioningPolicy
+		// fldPath is the field naming the resource, nil for the name derived from the arch.
+		fldPath *field.Path
+	}
+	origins := make(map[string]origin)
+	conflicts := make(map[string]struct{})
+
+	var errs field.ErrorList
+	resolve := func(resourceName string, policy furiosa_device.PartitioningPolicy, fldPath *field.Path) {
+		previous, exist := origins[resourceName]
+		if !exist {
+			origins[resourceName] = origin{policy: policy, fldPath: fldPath}
+			return
+		}
+
+		if _, reported := conflicts[resourceName]; reported || previous.policy == policy {
+			return
+		}
+		conflicts[resourceName] = struct{}{}
+
+		// the conflict is reported at the field naming the resource, since a name derived from an arch has no field.
+		if fldPath == nil {
+			fldPath = previous.fldPath
+		}
+		errs = append(errs, field.Invalid(fldPath, resourceName, fmt.Sprintf("resource name is used by the devices partitioned with both %s and %s policies", previous.policy, policy)))
+	}
+
+	for _, arch := range supportedArchs {
+		for _, supported := range supportedPartitioningPolicies {
+			policy := furiosa_device.PartitioningPolicy(supported)
+			var fldPath *field.Path
+			if index := c.resourceNameIndex(arch, policy); index >= 0 {
+				fldPath = field.NewPath("resourceNames").Index(index).Child("name")
+			}
+
+			domain, name := c.ResolveResourceName(arch, policy)
+			resolve(domain+"/"+name, policy, fldPath)
+		}
+	}
+
+	if c.UnknownArch.ResourceName != "" {
+		for _, supported := range supportedPartitioningPolicies {
+			policy := furiosa_device.PartitioningPolicy(supported)
+			resolve(c.ResourceDomain+"/"+PartitionedResourceName(c.UnknownArch.ResourceName, policy), policy, field.NewPath("unknownArch", "resourceName"))
+		}
+	}
+
+	return errs
+}
+
+func validateAllocator(fldPath *field.Path, allocator AllocatorType) field.ErrorList {
+	for _, supported := range supportedAllocators {
+		if string(allocator) == supported {
+			return nil
+		}
+	}
+
+	return field.ErrorList{field.NotSupported(fldPath, allocator, supportedAllocators)}
+}
+
+// validateFullResourceName checks the resource name in the form of domain/name as built by the device manager.
+func validateFullResourceName(fldPath *field.Path, resourceName string) field.ErrorList {
+	domain, name, found := strings.Cut(resourceName, "/")
+	if !found {
+		return field.ErrorList{field.Invalid(fldPath, resourceName, "must be in the form of domain/name")}
+	}
+
+	var errs field.ErrorList
+	for _, msg := range apivalidation.NameIsDNSSubdomain(domain, false) {
+		errs = append(errs, field.Invalid(fldPath, resourceName, msg))
+	}
+
+	for _, msg := range apivalidation.NameIsDNSSubdomain(name, false) {
+		errs = append(errs, field.Invalid(fldPath, resourceName, msg))
+	}
+
+	return errs
+}
+
+func validateDeviceInjection(fldPath *field.Path, mode DeviceInjectionMode) field.ErrorList {
+	for _, supported := range supportedDeviceInjectionModes {
+		if string(mode) == supported {
+			return nil
+		}
+	}
+
+	return field.ErrorList{field.NotSupported(fldPath, mode, supportedDeviceInjectionModes)}
+}
+
+func validateResourceNames(fldPath *field.Path, resourceNames []ResourceNameConfig) field.ErrorList {
+	var errs field.ErrorList
+
+	type selection struct {
+		arch   string
+		policy furiosa_device.PartitioningPolicy
+	}
+	selected := make(map[selection]struct{})
+
+	for i, resourceName := range resourceNames {
+		namePath := fldPath.Index(i)
+		if resourceName.Policy != "" {
+			errs = append(errs, validatePartitioningPolicy(namePath.Child("policy"), resourceName.Policy)...)
+		}
+
+		if len(resourceName.Archs) == 0 {
+			errs = append(errs, field.Required(namePath.Child("archs"), "at least one arch must be selected"))
+		}
+
+		for j, arch := range resourceName.Archs {
+			archPath := namePath.Child("archs").Index(j)
+			if archErrs := validateArch(archPath, arch); len(archErrs) > 0 {
+				errs = append(errs, archErrs...)
+				continue
+			}
+
+			key := selection{arch: arch, policy: resourceName.Policy}
+			if _, exist := selected[key]; exist {
+				errs = append(errs, field.Duplicate(archPath, arch))
+				continue
+			}
+			selected[key] = struct{}{}
+		}
+
+		// same as the validation of the resource names built by the device manager.
+		for _, msg := range apivalidation.NameIsDNSSubdomain(resourceName.Name, false) {
+			errs = append(errs, field.Invalid(namePath.Child("name"), resourceName.Name, msg))
+		}
+
+		if resourceName.Domain != "" {
+			for _, msg := range apivalidation.NameIsDNSSubdomain(resourceName.Domain, false) {
+				errs = append(errs, field.Invalid(namePath.Child("domain"), resourceName.Domain, msg))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,71 @@
+package device_manager
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+)
+
+// AllocatedDevice describes a device allocated to a container.
+type AllocatedDevice struct {
+	ID string `json:"id"`
+	// Arch, UUID, Index, BDF, Serial and FirmwareVersion are of the card of the device.
+	Arch            string `json:"arch"`
+	UUID            string `json:"uuid"`
+	Index           uint32 `json:"index"`
+	BDF             string `json:"bdf"`
+	Serial          string `json:"serial"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	NUMANode        int    `json:"numaNode"`
+	// StartCore and EndCore are the first and the last PE cores of the device.
+	StartCore uint32 `json:"startCore"`
+	EndCore   uint32 `json:"endCore"`
+	// TopologyGroup is the lowest index of the cards sharing the PCIe switch with the card.
+	TopologyGroup uint32 `json:"topologyGroup"`
+}
+
+// PECores returns the PE core range of the device, e.g. "0-3".
+func (a AllocatedDevice) PECores() string {
+	return fmt.Sprintf("%d-%d", a.StartCore, a.EndCore)
+}
+
+// allocatedDevices locates the devices on their cards, ordered by the index of the card and the PE cores.
+func (d *deviceManager) allocatedDevices(devices ...furiosa_device.FuriosaDevice) ([]AllocatedDevice, error) {
+	var allocated []AllocatedDevice
+
+	for _, device := range devices {
+		partition, exist := d.partitions[device.DeviceID()]
+		if !exist {
+			return nil, fmt.Errorf("couldn't locate device %s on the cards", device.DeviceID())
+		}
+
+		info, err := partition.card.DeviceInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		allocated = append(allocated, AllocatedDevice{
+			ID:              device.DeviceID(),
+			Arch:            info.Arch().ToString(),
+			UUID:            partition.uuid,
+			Index:           info.Index(),
+			BDF:             info.BDF(),
+			Serial:          info.Serial(),
+			FirmwareVersion: info.FirmwareVersion().String(),
+			NUMANode:        device.NUMANode(),
+			StartCore:       partition.start,
+			EndCore:         partition.end,
+			TopologyGroup:   d.topologyGroups[partition.uuid],
+		})
+	}
+
+	sort.Slice(allocated, func(i, j int) bool {
+		if allocated[i].Index != allocated[j].Index {
+			return allocated[i].Index < allocated[j].Index
+		}
+		return allocated[i].StartCore < allocated[j].StartCore
+	})
+
+	return allocated, nil
+}
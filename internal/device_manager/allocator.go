@@ -0,0 +1,329 @@
+package device_manager
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/bits"
+	"slices"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/npu_allocator"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/util"
+)
+
+// unknownTopology is the topology of a device whose card is unknown to the allocator, which is placed on its own.
+var unknownTopology = cardTopology{numaNode: -1, topologyGroup: math.MaxUint32}
+
+// cardTopology is the placement of a card, which is shared by the partitions of the card.
+type cardTopology struct {
+	numaNode      int
+	topologyGroup uint32
+	// partitions is the number of the devices advertised on the card with the partitioning policy.
+	partitions int
+}
+
+// cardTopologies is cardTopology keyed by npu_allocator.Device.TopologyHintKey, which is the PCI bus id of the card.
+type cardTopologies map[npu_allocator.TopologyHintKey]cardTopology
+
+func buildCardTopologies(cards []smi.Device, policy furiosa_device.PartitioningPolicy) (cardTopologies, error) {
+	topologyGroups, err := buildTopologyGroups(cards)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := buildDevicePartitions(cards, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionCounts := make(map[string]int)
+	for _, partition := range partitions {
+		partitionCounts[partition.uuid]++
+	}
+
+	topologies := make(cardTopologies, len(cards))
+	for _, card := range cards {
+		info, err := card.DeviceInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		busID, err := util.ParseBusIDFromBDF(info.BDF())
+		if err != nil {
+			return nil, err
+		}
+
+		topologies[npu_allocator.TopologyHintKey(busID)] = cardTopology{
+			numaNode:      int(info.NumaNode()),
+			topologyGroup: topologyGroups[info.UUID()],
+			partitions:    partitionCounts[info.UUID()],
+		}
+	}
+
+	return topologies, nil
+}
+
+func (t cardTopologies) of(device npu_allocator.Device) cardTopology {
+	if topology, exist := t[device.TopologyHintKey()]; exist {
+		return topology
+	}
+
+	return unknownTopology
+}
+
+// allocatorConfig selects the allocator of a resource.
+type allocatorConfig struct {
+	allocatorType config.AllocatorType
+	numaAffinity  bool
+	// searchBudget bounds the search of branchAndBoundNpuAllocator, the search is never cut if it is zero.
+	searchBudget time.Duration
+}
+
+func newNpuAllocator(allocatorCfg allocatorConfig, devices []smi.Device, policy furiosa_device.PartitioningPolicy) (npu_allocator.NpuAllocator, error) {
+	allocator, err := newInnerNpuAllocator(allocatorCfg, devices, policy)
+	if err != nil || !allocatorCfg.numaAffinity {
+		return allocator, err
+	}
+
+	return newNUMAAffinityNpuAllocator(devices, policy, allocator)
+}
+
+func newInnerNpuAllocator(allocatorCfg allocatorConfig, devices []smi.Device, policy furiosa_device.PartitioningPolicy) (npu_allocator.NpuAllocator, error) {
+	switch allocatorCfg.allocatorType {
+	case config.ScoreBasedAllocator:
+		return npu_allocator.NewScoreBasedOptimalNpuAllocator(devices)
+
+	case config.BinPackingAllocator:
+		return npu_allocator.NewBinPackingNpuAllocator(devices)
+
+	case config.BranchAndBoundAllocator:
+		return newBranchAndBoundNpuAllocator(devices, policy, allocatorCfg.searchBudget)
+
+	case config.SingleNUMAAllocator:
+		return newSingleNUMANpuAllocator(devices, policy, allocatorCfg.searchBudget)
+
+	case config.SpreadAllocator:
+		return newSpreadNpuAllocator(devices, policy)
+
+	default:
+		return nil, fmt.Errorf("unknown allocator %s", allocatorCfg.allocatorType)
+	}
+}
+
+var _ npu_allocator.NpuAllocator = (*singleNUMANpuAllocator)(nil)
+
+// singleNUMANpuAllocator allocates the devices of a single NUMA node only.
+// Among the nodes fitting the request, the node with the fewest available devices is chosen to keep the larger nodes for
+// the larger requests, and the devices in the node are chosen by inner.
+// It has no preference if the required devices span several nodes or no node fits, kubelet allocates the devices then.
+// The devices without NUMA node are never preferred, and the required ones don't restrict the node.
+type singleNUMANpuAllocator struct {
+	topologies cardTopologies
+	inner      npu_allocator.NpuAllocator
+}
+
+func newSingleNUMANpuAllocator(devices []smi.Device, policy furiosa_device.PartitioningPolicy, searchBudget time.Duration) (npu_allocator.NpuAllocator, error) {
+	topologies, err := buildCardTopologies(devices, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := newBranchAndBoundNpuAllocator(devices, policy, searchBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	return &singleNUMANpuAllocator{topologies: topologies, inner: inner}, nil
+}
+
+func (n *singleNUMANpuAllocator) Allocate(available npu_allocator.DeviceSet, required npu_allocator.DeviceSet, request int) npu_allocator.DeviceSet {
+	if required.Len() >= request {
+		return required
+	}
+
+	requiredNodes := make(map[int]struct{})
+	for _, device := range required.Devices() {
+		if node := n.topologies.of(device).numaNode; node >= 0 {
+			requiredNodes[node] = struct{}{}
+		}
+	}
+
+	if len(requiredNodes) > 1 {
+		return npu_allocator.NewDeviceSet()
+	}
+
+	candidates := make(map[int][]npu_allocator.Device)
+	for _, device := range available.Difference(required.Devices()...).Devices() {
+		if node := n.topologies.of(device).numaNode; node >= 0 {
+			candidates[node] = append(candidates[node], device)
+		}
+	}
+
+	// the nodes are visited in order to break the ties by the lowest node.
+	nodes := make([]int, 0, len(candidates))
+	for node := range candidates {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+
+	need := request - required.Len()
+	chosen := -1
+	for _, node := range nodes {
+		if _, exist := requiredNodes[node]; len(requiredNodes) > 0 && !exist {
+			continue
+		}
+
+		if len(candidates[node]) < need {
+			continue
+		}
+
+		if chosen == -1 || len(candidates[node]) < len(candidates[chosen]) {
+			chosen = node
+		}
+	}
+
+	if chosen == -1 {
+		return npu_allocator.NewDeviceSet()
+	}
+
+	return n.inner.Allocate(npu_allocator.NewDeviceSet(candidates[chosen]...).Union(required.Devices()...), required, request)
+}
+
+// maxNUMANodes is the largest number of the NUMA nodes aligned by the kubelet Topology Manager.
+const maxNUMANodes = 8
+
+var _ npu_allocator.NpuAllocator = (*numaAffinityNpuAllocator)(nil)
+
+// numaAffinityNpuAllocator restricts inner to the NUMA nodes which the kubelet Topology Manager aligns the devices to,
+// the narrowest set of the nodes having enough devices with the ties broken by the lowest nodes. kubelet counts only the
+// devices with NUMA node, and the set differs if other resources such as CPU narrow the hint.
+type numaAffinityNpuAllocator struct {
+	topologies cardTopologies
+	inner      npu_allocator.NpuAllocator
+}
+
+func newNUMAAffinityNpuAllocator(devices []smi.Device, policy furiosa_device.PartitioningPolicy, inner npu_allocator.NpuAllocator) (npu_allocator.NpuAllocator, error) {
+	topologies, err := buildCardTopologies(devices, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &numaAffinityNpuAllocator{topologies: topologies, inner: inner}, nil
+}
+
+func (n *numaAffinityNpuAllocator) Allocate(available npu_allocator.DeviceSet, required npu_allocator.DeviceSet, request int) npu_allocator.DeviceSet {
+	if required.Len() >= request {
+		return required
+	}
+
+	devicesOfNode := make(map[int][]npu_allocator.Device)
+	for _, device := range available.Union(required.Devices()...).Devices() {
+		if node := n.topologies.of(device).numaNode; node >= 0 {
+			devicesOfNode[node] = append(devicesOfNode[node], device)
+		}
+	}
+
+	nodes := slices.Sorted(maps.Keys(devicesOfNode))
+	if len(nodes) > maxNUMANodes {
+		return n.inner.Allocate(available, required, request)
+	}
+
+	// the bit i of a mask is nodes[i], so the lower mask has the lower nodes.
+	requiredMask := uint(0)
+	for _, device := range required.Devices() {
+		if node := n.topologies.of(device).numaNode; node >= 0 {
+			requiredMask |= 1 << slices.Index(nodes, node)
+		}
+	}
+
+	chosen := uint(0)
+	for mask := uint(1); mask < 1<<len(nodes); mask++ {
+		if mask&requiredMask != requiredMask {
+			continue
+		}
+
+		count := 0
+		for i, node := range nodes {
+			if mask&(1<<i) != 0 {
+				count += len(devicesOfNode[node])
+			}
+		}
+
+		if count < request {
+			continue
+		}
+
+		if chosen == 0 || bits.OnesCount(mask) < bits.OnesCount(chosen) || (bits.OnesCount(mask) == bits.OnesCount(chosen) && mask < chosen) {
+			chosen = mask
+		}
+	}
+
+	// kubelet has no preferred hint of the devices, the restricted and single-numa-node policies reject the pod then.
+	if chosen == 0 {
+		return n.inner.Allocate(available, required, request)
+	}
+
+	aligned := npu_allocator.NewDeviceSet(required.Devices()...)
+	for i, node := range nodes {
+		if chosen&(1<<i) != 0 {
+			aligned.Insert(devicesOfNode[node]...)
+		}
+	}
+
+	return n.inner.Allocate(aligned, required, request)
+}
+
+var _ npu_allocator.NpuAllocator = (*spreadNpuAllocator)(nil)
+
+// spreadNpuAllocator spreads the devices across the PCIe switches, so that a job bound by the host bandwidth doesn't share
+// the uplink of a switch. Each device is taken from the switch with the fewest allocated devices, then from the card with
+// the fewest allocated partitions, then by the lowest index.
+type spreadNpuAllocator struct {
+	topologies cardTopologies
+}
+
+func newSpreadNpuAllocator(devices []smi.Device, policy furiosa_device.PartitioningPolicy) (npu_allocator.NpuAllocator, error) {
+	topologies, err := buildCardTopologies(devices, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spreadNpuAllocator{topologies: topologies}, nil
+}
+
+func (n *spreadNpuAllocator) Allocate(available npu_allocator.DeviceSet, required npu_allocator.DeviceSet, request int) npu_allocator.DeviceSet {
+	allocated := npu_allocator.NewDeviceSet(required.Devices()...)
+	groupUsage := make(map[uint32]int)
+	cardUsage := make(map[npu_allocator.TopologyHintKey]int)
+
+	use := func(device npu_allocator.Device) {
+		groupUsage[n.topologies.of(device).topologyGroup]++
+		cardUsage[device.TopologyHintKey()]++
+	}
+
+	for _, device := range required.Devices() {
+		use(device)
+	}
+
+	// candidates are sorted by index, the first one wins the ties.
+	candidates := available.Difference(required.Devices()...).Devices()
+	for allocated.Len() < request && len(candidates) > 0 {
+		best := 0
+		for i := 1; i < len(candidates); i++ {
+			bestGroup, group := groupUsage[n.topologies.of(candidates[best]).topologyGroup], groupUsage[n.topologies.of(candidates[i]).topologyGroup]
+			if group < bestGroup || (group == bestGroup && cardUsage[candidates[i].TopologyHintKey()] < cardUsage[candidates[best].TopologyHintKey()]) {
+				best = i
+			}
+		}
+
+		allocated.Insert(candidates[best])
+		use(candidates[best])
+		candidates = slices.Delete(candidates, best, best+1)
+	}
+
+	return allocated
+}
@@ -0,0 +1,417 @@
+package device_manager
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+)
+
+// allocatorTestCase selects the mock devices by the suffix of the UUID, e.g. "0" or "0_cores_0-1" of the card 0.
+// The mock cards 0-3 are on NUMA node 0 and 4-7 on NUMA node 1 unless devices is given, and every two cards share a
+// PCIe switch.
+type allocatorTestCase struct {
+	description  string
+	devices      []smi.Device
+	numaAffinity bool
+	policy       furiosa_device.PartitioningPolicy
+	available    []string
+	required     []string
+	request      int
+	expected     []string
+}
+
+// numaDevice is a mock device on the given NUMA node, -1 if the node is unknown.
+type numaDevice struct {
+	smi.Device
+	numaNode int32
+}
+
+func (n numaDevice) DeviceInfo() (smi.DeviceInfo, error) {
+	info, err := n.Device.DeviceInfo()
+	return numaDeviceInfo{DeviceInfo: info, numaNode: n.numaNode}, err
+}
+
+// DeviceToDeviceLinkType unwraps the target, the static mock devices look up the link of the mock devices only.
+func (n numaDevice) DeviceToDeviceLinkType(target smi.Device) (smi.LinkType, error) {
+	if other, ok := target.(numaDevice); ok {
+		target = other.Device
+	}
+
+	return n.Device.DeviceToDeviceLinkType(target)
+}
+
+type numaDeviceInfo struct {
+	smi.DeviceInfo
+	numaNode int32
+}
+
+func (n numaDeviceInfo) NumaNode() int32 {
+	return n.numaNode
+}
+
+// mixedNUMADevices returns rngd cards 0-1 on NUMA node 0, 2-3 on node 1, 4-5 on node 2 and 6-7 on an unknown node.
+func mixedNUMADevices() []smi.Device {
+	devices := smi.GetStaticMockDevices(smi.ArchRngd)
+	for i := range devices {
+		numaNode := int32(i / 2)
+		if numaNode > 2 {
+			numaNode = -1
+		}
+		devices[i] = numaDevice{Device: devices[i], numaNode: numaNode}
+	}
+
+	return devices
+}
+
+// allDevices returns the suffixes of every mock device partitioned with the policy.
+func allDevices(policy furiosa_device.PartitioningPolicy) []string {
+	var suffixes []string
+	for card := 0; card < 8; card++ {
+		switch policy {
+		case furiosa_device.DualCorePolicy:
+			for _, cores := range []string{"0-1", "2-3", "4-5", "6-7"} {
+				suffixes = append(suffixes, strconv.Itoa(card)+"_cores_"+cores)
+			}
+		default:
+			suffixes = append(suffixes, strconv.Itoa(card))
+		}
+	}
+
+	return suffixes
+}
+
+func runAllocatorTests(t *testing.T, allocator config.AllocatorType, tests []allocatorTestCase) {
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assertPreferredAllocation(t, allocator, tc)
+		})
+	}
+}
+
+func assertPreferredAllocation(t *testing.T, allocator config.AllocatorType, tc allocatorTestCase) {
+	const uuidPrefix = "A76AAD68-6855-40B1-9E86-D080852D1C8"
+
+	cfg := config.NewDefaultConfig()
+	cfg.ResourceAllocators = map[string]config.AllocatorType{"furiosa.ai/npu": allocator}
+	cfg.NUMAAffinity = tc.numaAffinity
+
+	devices := tc.devices
+	if devices == nil {
+		devices = smi.GetStaticMockDevices(smi.ArchRngd)
+	}
+
+	manager, err := NewDeviceManager("furiosa.ai/npu", tc.policy, devices, nil, cfg)
+	assert.NoError(t, err)
+
+	available := tc.available
+	if available == nil {
+		available = allDevices(tc.policy)
+	}
+
+	actual, err := manager.GetContainerPreferredAllocationResponse(prefix(uuidPrefix, available), prefix(uuidPrefix, tc.required), tc.request)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, prefix(uuidPrefix, tc.expected), actual.DeviceIDs)
+}
+
+// TestAllocators runs the same requests through the allocators, the expected devices are by the allocator.
+// score-based is skipped for the partitions and the request larger than the available devices.
+func TestAllocators(t *testing.T) {
+	tests := []struct {
+		description string
+		policy      furiosa_device.PartitioningPolicy
+		available   []string
+		required    []string
+		request     int
+		expected    map[config.AllocatorType][]string
+	}{
+		{
+			description: "request one device",
+			policy:      furiosa_device.NonePolicy,
+			request:     1,
+			expected: map[config.AllocatorType][]string{
+				config.ScoreBasedAllocator:     {"0"},
+				config.BinPackingAllocator:     {"0"},
+				config.BranchAndBoundAllocator: {"0"},
+				config.SingleNUMAAllocator:     {"0"},
+				config.SpreadAllocator:         {"0"},
+			},
+		},
+		{
+			description: "request two devices",
+			policy:      furiosa_device.NonePolicy,
+			request:     2,
+			expected: map[config.AllocatorType][]string{
+				config.ScoreBasedAllocator:     {"0", "1"},
+				config.BinPackingAllocator:     {"0", "1"},
+				config.BranchAndBoundAllocator: {"0", "1"},
+				config.SingleNUMAAllocator:     {"0", "1"},
+				config.SpreadAllocator:         {"0", "2"},
+			},
+		},
+		{
+			description: "request four devices with the required device",
+			policy:      furiosa_device.NonePolicy,
+			required:    []string{"6"},
+			request:     4,
+			expected: map[config.AllocatorType][]string{
+				config.ScoreBasedAllocator:     {"4", "5", "6", "7"},
+				config.BinPackingAllocator:     {"4", "5", "6", "7"},
+				config.BranchAndBoundAllocator: {"4", "5", "6", "7"},
+				config.SingleNUMAAllocator:     {"4", "5", "6", "7"},
+				config.SpreadAllocator:         {"0", "2", "4", "6"},
+			},
+		},
+		{
+			description: "request the partitions of a card",
+			policy:      furiosa_device.DualCorePolicy,
+			request:     4,
+			expected: map[config.AllocatorType][]string{
+				config.BinPackingAllocator:     {"0_cores_0-1", "0_cores_2-3", "0_cores_4-5", "0_cores_6-7"},
+				config.BranchAndBoundAllocator: {"0_cores_0-1", "0_cores_2-3", "0_cores_4-5", "0_cores_6-7"},
+				config.SingleNUMAAllocator:     {"0_cores_0-1", "0_cores_2-3", "0_cores_4-5", "0_cores_6-7"},
+				config.SpreadAllocator:         {"0_cores_0-1", "2_cores_0-1", "4_cores_0-1", "6_cores_0-1"},
+			},
+		},
+		{
+			description: "request every device",
+			policy:      furiosa_device.NonePolicy,
+			request:     8,
+			expected: map[config.AllocatorType][]string{
+				config.ScoreBasedAllocator:     {"0", "1", "2", "3", "4", "5", "6", "7"},
+				config.BinPackingAllocator:     {"0", "1", "2", "3", "4", "5", "6", "7"},
+				config.BranchAndBoundAllocator: {"0", "1", "2", "3", "4", "5", "6", "7"},
+				config.SingleNUMAAllocator:     nil,
+				config.SpreadAllocator:         {"0", "1", "2", "3", "4", "5", "6", "7"},
+			},
+		},
+		{
+			description: "request more devices than available",
+			policy:      furiosa_device.NonePolicy,
+			available:   []string{"0", "1"},
+			request:     3,
+			expected: map[config.AllocatorType][]string{
+				config.BinPackingAllocator:     nil,
+				config.BranchAndBoundAllocator: {"0", "1"},
+				config.SingleNUMAAllocator:     nil,
+				config.SpreadAllocator:         {"0", "1"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		for allocator, expected := range tc.expected {
+			t.Run(string(allocator)+"/"+tc.description, func(t *testing.T) {
+				assertPreferredAllocation(t, allocator, allocatorTestCase{
+					policy:    tc.policy,
+					available: tc.available,
+					required:  tc.required,
+					request:   tc.request,
+					expected:  expected,
+				})
+			})
+		}
+	}
+}
+
+func TestBinPackingNpuAllocator(t *testing.T) {
+	runAllocatorTests(t, config.BinPackingAllocator, []allocatorTestCase{
+		{
+			description: "pack the partitions into a single card",
+			policy:      furiosa_device.DualCorePolicy,
+			request:     2,
+			expected:    []string{"0_cores_0-1", "0_cores_2-3"},
+		},
+		{
+			description: "pack the partitions into the card of the required partition",
+			policy:      furiosa_device.DualCorePolicy,
+			required:    []string{"1_cores_2-3"},
+			request:     3,
+			expected:    []string{"1_cores_0-1", "1_cores_2-3", "1_cores_4-5"},
+		},
+	})
+}
+
+func TestSingleNUMANpuAllocator(t *testing.T) {
+	runAllocatorTests(t, config.SingleNUMAAllocator, []allocatorTestCase{
+		{
+			description: "request three devices from the node with the fewest available devices",
+			policy:      furiosa_device.NonePolicy,
+			available:   []string{"0", "1", "2", "4", "5", "6", "7"},
+			request:     3,
+			expected:    []string{"0", "1", "2"},
+		},
+		{
+			description: "skip the node without enough devices",
+			policy:      furiosa_device.NonePolicy,
+			available:   []string{"0", "4", "5", "6"},
+			request:     2,
+			expected:    []string{"4", "5"},
+		},
+		{
+			description: "request two devices from the node of the required device",
+			policy:      furiosa_device.NonePolicy,
+			required:    []string{"5"},
+			request:     2,
+			expected:    []string{"4", "5"},
+		},
+		{
+			description: "no preference for the required devices spanning the nodes",
+			policy:      furiosa_device.NonePolicy,
+			required:    []string{"1", "5"},
+			request:     3,
+			expected:    nil,
+		},
+		{
+			description: "no preference for the request larger than any node",
+			policy:      furiosa_device.NonePolicy,
+			request:     5,
+			expected:    nil,
+		},
+		{
+			description: "request the partitions of a single node",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   []string{"3_cores_0-1", "3_cores_2-3", "4_cores_0-1", "4_cores_2-3", "5_cores_0-1"},
+			request:     3,
+			expected:    []string{"4_cores_0-1", "4_cores_2-3", "5_cores_0-1"},
+		},
+		{
+			description: "no preference for the devices without NUMA node",
+			devices:     mixedNUMADevices(),
+			policy:      furiosa_device.NonePolicy,
+			available:   []string{"0", "6", "7"},
+			request:     2,
+			expected:    nil,
+		},
+		{
+			description: "the required device without NUMA node doesn't restrict the node",
+			devices:     mixedNUMADevices(),
+			policy:      furiosa_device.NonePolicy,
+			required:    []string{"6"},
+			request:     3,
+			expected:    []string{"0", "1", "6"},
+		},
+	})
+}
+
+// TestNUMAAffinityNpuAllocator follows the NUMA nodes which the kubelet Topology Manager aligns the devices to with the
+// single-numa-node policy if the request fits in a single node, and with the restricted policy otherwise.
+func TestNUMAAffinityNpuAllocator(t *testing.T) {
+	runAllocatorTests(t, config.BranchAndBoundAllocator, []allocatorTestCase{
+		{
+			description:  "single-numa-node: request the devices of the lowest node",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			request:      2,
+			expected:     []string{"0", "1"},
+		},
+		{
+			description:  "single-numa-node: skip the node without enough devices",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			available:    []string{"0", "2", "3", "4", "5"},
+			request:      2,
+			expected:     []string{"2", "3"},
+		},
+		{
+			description:  "single-numa-node: request the devices of the node of the required device",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			required:     []string{"2"},
+			request:      2,
+			expected:     []string{"2", "3"},
+		},
+		{
+			description:  "single-numa-node: request the partitions of the lowest node",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.DualCorePolicy,
+			available:    []string{"1_cores_0-1", "2_cores_0-1", "2_cores_2-3", "5_cores_0-1", "5_cores_2-3", "5_cores_4-5"},
+			request:      3,
+			expected:     []string{"5_cores_0-1", "5_cores_2-3", "5_cores_4-5"},
+		},
+		{
+			description:  "restricted: request the devices of the lowest nodes for the request larger than any node",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			required:     []string{"2"},
+			request:      4,
+			expected:     []string{"0", "1", "2", "3"},
+		},
+		{
+			description:  "restricted: request the devices of the nodes rather than the closer devices without NUMA node",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			required:     []string{"5"},
+			request:      3,
+			expected:     []string{"0", "4", "5"},
+		},
+		{
+			description:  "restricted: request among the devices of the hinted nodes sent by kubelet",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			available:    []string{"0", "1", "2", "3"},
+			request:      3,
+			expected:     []string{"0", "1", "2"},
+		},
+		{
+			description:  "restricted: request the devices of the narrowest nodes of the required devices",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			required:     []string{"0", "4"},
+			request:      4,
+			expected:     []string{"0", "1", "4", "5"},
+		},
+		{
+			description:  "no preferred hint for the request larger than the devices",
+			devices:      mixedNUMADevices(),
+			numaAffinity: true,
+			policy:       furiosa_device.NonePolicy,
+			available:    []string{"0", "1", "2"},
+			request:      4,
+			expected:     []string{"0", "1", "2"},
+		},
+	})
+}
+
+func TestSpreadNpuAllocator(t *testing.T) {
+	runAllocatorTests(t, config.SpreadAllocator, []allocatorTestCase{
+		{
+			description: "request four devices from every switch",
+			policy:      furiosa_device.NonePolicy,
+			request:     4,
+			expected:    []string{"0", "2", "4", "6"},
+		},
+		{
+			description: "request two devices from the switches other than the one of the required device",
+			policy:      furiosa_device.NonePolicy,
+			required:    []string{"0"},
+			request:     2,
+			expected:    []string{"0", "2"},
+		},
+		{
+			description: "share a switch only after every switch is used",
+			policy:      furiosa_device.NonePolicy,
+			available:   []string{"0", "1", "2", "3"},
+			request:     3,
+			expected:    []string{"0", "1", "2"},
+		},
+		{
+			description: "spread the partitions across the cards under a switch",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   []string{"0_cores_0-1", "0_cores_2-3", "1_cores_0-1", "1_cores_2-3"},
+			request:     2,
+			expected:    []string{"0_cores_0-1", "1_cores_0-1"},
+		},
+	})
+}
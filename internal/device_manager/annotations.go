@@ -0,0 +1,19 @@
+package device_manager
+
+import (
+	"encoding/json"
+)
+
+// AllocatedDevicesAnnotation is the annotation of the containers holding the JSON list of AllocatedDevice,
+// which the container runtime passes to the OCI hooks.
+const AllocatedDevicesAnnotation = "furiosa.ai/allocated-devices"
+
+// buildAnnotations returns the annotations describing the hardware allocated to the container.
+func buildAnnotations(devices []AllocatedDevice) (map[string]string, error) {
+	raw, err := json.Marshal(devices)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{AllocatedDevicesAnnotation: string(raw)}, nil
+}
@@ -0,0 +1,54 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerAllocateResponseAnnotations(t *testing.T) {
+	manager, err := NewDeviceManager("furiosa.ai/rngd-2core", furiosa_device.DualCorePolicy, smi.GetStaticMockDevices(smi.ArchRngd), nil, config.NewDefaultConfig())
+	assert.NoError(t, err)
+
+	actual, err := manager.GetContainerAllocateResponse([]string{
+		"A76AAD68-6855-40B1-9E86-D080852D1C83_cores_6-7",
+		"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_0-1",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, actual.Annotations, 1)
+
+	var devices []AllocatedDevice
+	assert.NoError(t, json.Unmarshal([]byte(actual.Annotations[AllocatedDevicesAnnotation]), &devices))
+	assert.Equal(t, []AllocatedDevice{
+		{
+			ID:              "A76AAD68-6855-40B1-9E86-D080852D1C82_cores_0-1",
+			Arch:            "rngd",
+			UUID:            "A76AAD68-6855-40B1-9E86-D080852D1C82",
+			Index:           2,
+			BDF:             "0000:51:00.0",
+			Serial:          "TEST0236FH505KRE2",
+			FirmwareVersion: "1.6.0(dev0), c1bebfd",
+			NUMANode:        0,
+			StartCore:       0,
+			EndCore:         1,
+			TopologyGroup:   2,
+		},
+		{
+			ID:              "A76AAD68-6855-40B1-9E86-D080852D1C83_cores_6-7",
+			Arch:            "rngd",
+			UUID:            "A76AAD68-6855-40B1-9E86-D080852D1C83",
+			Index:           3,
+			BDF:             "0000:57:00.0",
+			Serial:          "TEST0236FH505KRE3",
+			FirmwareVersion: "1.6.0(dev0), c1bebfd",
+			NUMANode:        0,
+			StartCore:       6,
+			EndCore:         7,
+			TopologyGroup:   2,
+		},
+	}, devices)
+}
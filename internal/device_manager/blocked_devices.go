@@ -0,0 +1,66 @@
+package device_manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+)
+
+const (
+	BlockSourceConfig         = "configuration"
+	blockSourceNodeAnnotation = "node annotation %s"
+	blockedReasonExp          = "blocked by %s with selector %q"
+)
+
+// BlockedDeviceSelector is a selector of a blocked card with the source requesting the block.
+type BlockedDeviceSelector struct {
+	Selector string
+	Source   string
+}
+
+// NewBlockedDeviceSelectors wraps selectors with the given source.
+func NewBlockedDeviceSelectors(source string, selectors ...string) []BlockedDeviceSelector {
+	var ret []BlockedDeviceSelector
+	for _, selector := range selectors {
+		ret = append(ret, BlockedDeviceSelector{Selector: selector, Source: source})
+	}
+
+	return ret
+}
+
+// ParseBlockedDevicesAnnotation parses comma separated selectors stored in the node annotation.
+func ParseBlockedDevicesAnnotation(annotationKey string, value string) []BlockedDeviceSelector {
+	var selectors []string
+	for _, selector := range strings.Split(value, ",") {
+		if selector = strings.TrimSpace(selector); selector != "" {
+			selectors = append(selectors, selector)
+		}
+	}
+
+	return NewBlockedDeviceSelectors(fmt.Sprintf(blockSourceNodeAnnotation, annotationKey), selectors...)
+}
+
+// resolveBlockedDevices returns the reason of the block keyed by UUID for the devices pointed by the selectors.
+func resolveBlockedDevices(devices []smi.Device, selectors []BlockedDeviceSelector) (map[string]string, error) {
+	blocked := make(map[string]string)
+	if len(selectors) == 0 {
+		return blocked, nil
+	}
+
+	for _, device := range devices {
+		info, err := device.DeviceInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, selector := range selectors {
+			if matchDevice(info, selector.Selector) {
+				blocked[info.UUID()] = fmt.Sprintf(blockedReasonExp, selector.Source, selector.Selector)
+				break
+			}
+		}
+	}
+
+	return blocked, nil
+}
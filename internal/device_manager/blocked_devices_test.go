@@ -0,0 +1,86 @@
+package device_manager
+
+import (
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBlockedDevicesAnnotation(t *testing.T) {
+	actual := ParseBlockedDevicesAnnotation("furiosa.ai/blocked-devices", " 0, TEST0236FH505KRE3 ,,0000:9e:00.0")
+	assert.Equal(t, []BlockedDeviceSelector{
+		{Selector: "0", Source: "node annotation furiosa.ai/blocked-devices"},
+		{Selector: "TEST0236FH505KRE3", Source: "node annotation furiosa.ai/blocked-devices"},
+		{Selector: "0000:9e:00.0", Source: "node annotation furiosa.ai/blocked-devices"},
+	}, actual)
+}
+
+func TestResolveBlockedDevices(t *testing.T) {
+	tests := []struct {
+		description    string
+		selectors      []BlockedDeviceSelector
+		expectedResult map[string]string
+	}{
+		{
+			description:    "no blocked device",
+			selectors:      nil,
+			expectedResult: map[string]string{},
+		},
+		{
+			description: "block devices by uuid, serial, bdf and index",
+			selectors: append(
+				NewBlockedDeviceSelectors(BlockSourceConfig, "A76AAD68-6855-40B1-9E86-D080852D1C80", "TEST0236FH505KRE1"),
+				ParseBlockedDevicesAnnotation("furiosa.ai/blocked-devices", "0000:51:00.0,7")...,
+			),
+			expectedResult: map[string]string{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80": `blocked by configuration with selector "A76AAD68-6855-40B1-9E86-D080852D1C80"`,
+				"A76AAD68-6855-40B1-9E86-D080852D1C81": `blocked by configuration with selector "TEST0236FH505KRE1"`,
+				"A76AAD68-6855-40B1-9E86-D080852D1C82": `blocked by node annotation furiosa.ai/blocked-devices with selector "0000:51:00.0"`,
+				"A76AAD68-6855-40B1-9E86-D080852D1C87": `blocked by node annotation furiosa.ai/blocked-devices with selector "7"`,
+			},
+		},
+		{
+			description:    "selector matching nothing",
+			selectors:      NewBlockedDeviceSelectors(BlockSourceConfig, "42"),
+			expectedResult: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			actual, err := resolveBlockedDevices(smi.GetStaticMockDevices(smi.ArchRngd), tc.selectors)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, actual)
+		})
+	}
+}
+
+func TestGetListAndWatchResponseWithBlockedDevices(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	mockManager, err := NewDeviceManager("furiosa.ai/rngd", furiosa_device.NonePolicy, mockDevices, NewBlockedDeviceSelectors(BlockSourceConfig, "3"), config.NewDefaultConfig())
+	assert.NoError(t, err)
+
+	for _, device := range mockManager.GetListAndWatchResponse().Devices {
+		if device.ID == "A76AAD68-6855-40B1-9E86-D080852D1C83" {
+			assert.Equal(t, "Unhealthy", device.Health)
+		} else {
+			assert.Equal(t, "Healthy", device.Health)
+		}
+	}
+}
+
+func TestFuriosaDevicesWithBlockedDevices(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	mockManager, err := NewDeviceManager("furiosa.ai/rngd-2core", furiosa_device.DualCorePolicy, mockDevices, NewBlockedDeviceSelectors(BlockSourceConfig, "3"), config.NewDefaultConfig())
+	assert.NoError(t, err)
+
+	// the partitions of the blocked card can't be allocated.
+	furiosaDevices := mockManager.FuriosaDevices()
+	assert.Len(t, furiosaDevices, 28)
+	for _, device := range furiosaDevices {
+		assert.NotContains(t, device.DeviceID(), "A76AAD68-6855-40B1-9E86-D080852D1C83")
+	}
+}
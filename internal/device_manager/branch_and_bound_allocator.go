@@ -0,0 +1,374 @@
+package device_manager
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/npu_allocator"
+)
+
+// deadlineCheckInterval is the number of the visited branches between the checks of the deadline.
+const deadlineCheckInterval = 1024
+
+var _ npu_allocator.NpuAllocator = (*branchAndBoundNpuAllocator)(nil)
+
+// branchAndBoundNpuAllocator prefers the devices with the highest sum of the link scores of every pair, which is the same
+// objective as the exhaustive score-based allocator of npu_allocator.
+// The partitions of a card share the links of the card, so it searches how many devices are taken from each card rather
+// than every subset of the devices, and prunes the branches which can't beat the best allocation found so far.
+// Among the allocations of the same score, it prefers the partitions of the partially used cards to keep the free cards
+// for the larger requests.
+// The greedy allocation is the initial best one, which is returned as is if the budget expires before the search finds
+// a better one. The search is never cut without budget, so that the result doesn't depend on the load of the node.
+type branchAndBoundNpuAllocator struct {
+	hintProvider npu_allocator.TopologyHintProvider
+	topologies   cardTopologies
+	budget       time.Duration
+}
+
+func newBranchAndBoundNpuAllocator(devices []smi.Device, policy furiosa_device.PartitioningPolicy, budget time.Duration) (npu_allocator.NpuAllocator, error) {
+	topologyHintMatrix, err := npu_allocator.NewTopologyHintMatrix(devices)
+	if err != nil {
+		return nil, err
+	}
+
+	topologies, err := buildCardTopologies(devices, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &branchAndBoundNpuAllocator{
+		hintProvider: newTopologyHintProvider(topologyHintMatrix),
+		topologies:   topologies,
+		budget:       budget,
+	}, nil
+}
+
+// newTopologyHintProvider looks up the score of two devices in the matrix, which has the pairs of the ordered keys only.
+func newTopologyHintProvider(topologyHintMatrix npu_allocator.TopologyHintMatrix) npu_allocator.TopologyHintProvider {
+	return func(device1, device2 npu_allocator.Device) uint {
+		key1, key2 := device1.TopologyHintKey(), device2.TopologyHintKey()
+		if key1 > key2 {
+			key1, key2 = key2, key1
+		}
+
+		return topologyHintMatrix[key1][key2]
+	}
+}
+
+// allocationCard is the devices of a card, the required devices are always allocated.
+type allocationCard struct {
+	required   []npu_allocator.Device
+	candidates []npu_allocator.Device
+}
+
+// allocationSearch is the state of a single Allocate call.
+type allocationSearch struct {
+	cards []allocationCard
+	// scores is the link score of every pair of the cards, including a card with itself for the partitions of the card.
+	// The link scores are scaled to exceed the sum of the used partitions of the cards, which are added to the gains
+	// at first, so that the used partitions break the ties of the link scores only.
+	scores [][]uint
+	// gains is the score added by allocating one more device of each card to the current allocation.
+	gains []uint
+	// suffixCapacity is the number of the candidates of the cards from each card, and suffixMaxCapacity is the largest one.
+	suffixCapacity    []int
+	suffixMaxCapacity []int
+	// suffixMaxSelf and suffixMaxCross are the highest scores of the cards from each card, with itself and with another.
+	suffixMaxSelf  []uint
+	suffixMaxCross []uint
+	// interchangeable is true if the card has the same links, candidates and required devices as the previous card.
+	// The card doesn't take more devices than the previous one, so that the same allocation isn't searched twice.
+	interchangeable []bool
+	// slots is the buffer of bound.
+	slots []int
+
+	counts     []int
+	score      uint
+	bestCounts []int
+	bestScore  uint
+
+	deadline time.Time
+	visited  int
+	expired  bool
+}
+
+func (n *branchAndBoundNpuAllocator) Allocate(available npu_allocator.DeviceSet, required npu_allocator.DeviceSet, request int) npu_allocator.DeviceSet {
+	if required.Len() >= request {
+		return required
+	}
+
+	s := n.newAllocationSearch(available, required)
+	need := min(request-required.Len(), s.suffixCapacity[0])
+
+	// the deadline includes the greedy allocation, so that the search expires at the first check if the budget is spent.
+	if n.budget > 0 {
+		s.deadline = time.Now().Add(n.budget)
+	}
+	s.greedy(need, required.Len() > 0)
+	s.branch(0, need)
+	if s.expired {
+		metrics.AllocationSearchExpirations.Inc()
+	}
+
+	return s.best(required)
+}
+
+// newAllocationSearch groups the devices by card in the order of the index, and allocates the required devices.
+func (n *branchAndBoundNpuAllocator) newAllocationSearch(available npu_allocator.DeviceSet, required npu_allocator.DeviceSet) *allocationSearch {
+	s := &allocationSearch{}
+
+	cardOf := make(map[npu_allocator.TopologyHintKey]int)
+	var representatives []npu_allocator.Device
+	for _, device := range available.Union(required.Devices()...).Devices() {
+		idx, exist := cardOf[device.TopologyHintKey()]
+		if !exist {
+			idx = len(s.cards)
+			cardOf[device.TopologyHintKey()] = idx
+			s.cards = append(s.cards, allocationCard{})
+			representatives = append(representatives, device)
+		}
+
+		if required.Contains(device) {
+			s.cards[idx].required = append(s.cards[idx].required, device)
+		} else {
+			s.cards[idx].candidates = append(s.cards[idx].candidates, device)
+		}
+	}
+
+	cardCount := len(s.cards)
+	s.gains = make([]uint, cardCount)
+	scale := uint(1)
+	for i, card := range s.cards {
+		// the devices missing from the card are allocated to the other containers, or unhealthy.
+		used := max(n.topologies.of(representatives[i]).partitions-len(card.required)-len(card.candidates), 0)
+		s.gains[i] = uint(used)
+		scale += uint(len(card.candidates) * used)
+	}
+
+	s.scores = make([][]uint, cardCount)
+	for i := range s.cards {
+		s.scores[i] = make([]uint, cardCount)
+		for j := range s.cards {
+			s.scores[i][j] = scale * n.hintProvider(representatives[i], representatives[j])
+		}
+	}
+
+	s.suffixCapacity = make([]int, cardCount+1)
+	s.suffixMaxCapacity = make([]int, cardCount+1)
+	s.suffixMaxSelf = make([]uint, cardCount+1)
+	s.suffixMaxCross = make([]uint, cardCount+1)
+	for i := cardCount - 1; i >= 0; i-- {
+		capacity := len(s.cards[i].candidates)
+		s.suffixCapacity[i] = s.suffixCapacity[i+1] + capacity
+		s.suffixMaxCapacity[i] = max(s.suffixMaxCapacity[i+1], capacity)
+		s.suffixMaxSelf[i] = max(s.suffixMaxSelf[i+1], s.scores[i][i])
+		s.suffixMaxCross[i] = s.suffixMaxCross[i+1]
+		for j := i + 1; j < cardCount; j++ {
+			s.suffixMaxCross[i] = max(s.suffixMaxCross[i], s.scores[i][j])
+		}
+	}
+
+	s.interchangeable = make([]bool, cardCount)
+	for i := 1; i < cardCount; i++ {
+		s.interchangeable[i] = s.isInterchangeable(i-1, i)
+	}
+	s.slots = make([]int, 0, cardCount)
+
+	s.counts = make([]int, cardCount)
+	for i, card := range s.cards {
+		s.add(i, len(card.required))
+	}
+
+	return s
+}
+
+// best returns the required devices and the best allocation found so far.
+func (s *allocationSearch) best(required npu_allocator.DeviceSet) npu_allocator.DeviceSet {
+	allocated := npu_allocator.NewDeviceSet(required.Devices()...)
+	for i, card := range s.cards {
+		allocated.Insert(card.candidates[:s.bestCounts[i]]...)
+	}
+
+	return allocated
+}
+
+// isInterchangeable returns whether swapping the cards doesn't change the score of any allocation.
+func (s *allocationSearch) isInterchangeable(a int, b int) bool {
+	if len(s.cards[a].candidates) != len(s.cards[b].candidates) || len(s.cards[a].required) != len(s.cards[b].required) {
+		return false
+	}
+
+	if s.scores[a][a] != s.scores[b][b] || s.gains[a] != s.gains[b] {
+		return false
+	}
+
+	for k := range s.cards {
+		if k != a && k != b && s.scores[a][k] != s.scores[b][k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// add allocates count more devices of the card, and returns the score added.
+// The counts are of the candidates, the required devices are added to the score and the gains only.
+func (s *allocationSearch) add(card int, count int) uint {
+	c := uint(count)
+	added := c*s.gains[card] + c*(c-1)/2*s.scores[card][card]
+	for j := range s.gains {
+		s.gains[j] += c * s.scores[card][j]
+	}
+
+	s.score += added
+	return added
+}
+
+// remove reverts add.
+func (s *allocationSearch) remove(card int, count int, added uint) {
+	c := uint(count)
+	for j := range s.gains {
+		s.gains[j] -= c * s.scores[card][j]
+	}
+
+	s.score -= added
+}
+
+// greedy allocates the device adding the highest score one by one, and the best of them is the initial best allocation
+// of the search. Without the required devices every device adds nothing at first, so each card is tried as the first one.
+func (s *allocationSearch) greedy(need int, hasRequired bool) {
+	s.bestCounts = make([]int, len(s.cards))
+
+	seeds := []int{-1}
+	if !hasRequired {
+		seeds = seeds[:0]
+		for i, card := range s.cards {
+			if len(card.candidates) > 0 {
+				seeds = append(seeds, i)
+			}
+		}
+	}
+
+	type step struct {
+		card  int
+		added uint
+	}
+
+	found := false
+	for _, seed := range seeds {
+		var steps []step
+		allocate := func(card int) {
+			steps = append(steps, step{card: card, added: s.add(card, 1)})
+			s.counts[card]++
+		}
+
+		if seed >= 0 && need > 0 {
+			allocate(seed)
+		}
+
+		for len(steps) < need {
+			best := -1
+			for i, card := range s.cards {
+				if s.counts[i] < len(card.candidates) && (best == -1 || s.gains[i] > s.gains[best]) {
+					best = i
+				}
+			}
+
+			allocate(best)
+		}
+
+		if !found || s.score > s.bestScore {
+			found = true
+			s.bestScore = s.score
+			copy(s.bestCounts, s.counts)
+		}
+
+		for i := len(steps) - 1; i >= 0; i-- {
+			s.remove(steps[i].card, 1, steps[i].added)
+			s.counts[steps[i].card]--
+		}
+	}
+}
+
+// branch decides the number of the devices of the card and the following cards to allocate the remaining devices.
+func (s *allocationSearch) branch(card int, remaining int) {
+	if remaining == 0 {
+		if s.score > s.bestScore {
+			s.bestScore = s.score
+			copy(s.bestCounts, s.counts)
+		}
+		return
+	}
+
+	if card == len(s.cards) || s.suffixCapacity[card] < remaining {
+		return
+	}
+
+	if s.visited%deadlineCheckInterval == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.expired = true
+	}
+	s.visited++
+
+	if s.expired || s.bound(card, remaining) <= s.bestScore {
+		return
+	}
+
+	limit := min(len(s.cards[card].candidates), remaining)
+	if s.interchangeable[card] {
+		limit = min(limit, s.counts[card-1])
+	}
+
+	for count := limit; count >= 0; count-- {
+		added := s.add(card, count)
+		s.counts[card] += count
+		s.branch(card+1, remaining-count)
+		s.counts[card] -= count
+		s.remove(card, count, added)
+
+		if s.expired {
+			return
+		}
+	}
+}
+
+// bound is the highest score reachable by allocating the remaining devices of the card and the following cards.
+// Each device adds at most the gain of its card to the current allocation, so the devices add at most the highest gains
+// of the candidates. Each pair of the remaining devices adds at most the highest score with itself if they are of the same
+// card, and there are the most of such pairs when the devices are packed into the largest cards, unless another card
+// scores higher.
+func (s *allocationSearch) bound(card int, remaining int) uint {
+	s.slots = s.slots[:0]
+	for j := card; j < len(s.cards); j++ {
+		if len(s.cards[j].candidates) > 0 {
+			s.slots = append(s.slots, j)
+		}
+	}
+	slices.SortFunc(s.slots, func(a, b int) int {
+		return cmp.Compare(s.gains[b], s.gains[a])
+	})
+
+	bound := s.score
+	left := remaining
+	for _, j := range s.slots {
+		taken := min(len(s.cards[j].candidates), left)
+		bound += uint(taken) * s.gains[j]
+		left -= taken
+		if left == 0 {
+			break
+		}
+	}
+
+	r, capacity := uint(remaining), uint(s.suffixMaxCapacity[card])
+	pairs := r * (r - 1) / 2
+	if s.suffixMaxSelf[card] < s.suffixMaxCross[card] {
+		return bound + pairs*s.suffixMaxCross[card]
+	}
+
+	samePairs := (r/capacity)*capacity*(capacity-1)/2 + (r%capacity)*(r%capacity-1)/2
+	return bound + samePairs*s.suffixMaxSelf[card] + (pairs-samePairs)*s.suffixMaxCross[card]
+}
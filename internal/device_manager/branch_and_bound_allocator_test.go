@@ -0,0 +1,291 @@
+package device_manager
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/npu_allocator"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// scoreOf returns the sum of the link scores of every pair of the devices.
+func scoreOf(hintProvider npu_allocator.TopologyHintProvider, devices npu_allocator.DeviceSet) uint {
+	score := uint(0)
+	for i, d1 := range devices.Devices() {
+		for _, d2 := range devices.Devices()[i+1:] {
+			score += hintProvider(d1, d2)
+		}
+	}
+
+	return score
+}
+
+func TestBranchAndBoundNpuAllocator(t *testing.T) {
+	runAllocatorTests(t, config.BranchAndBoundAllocator, []allocatorTestCase{
+		{
+			description: "request the partitions of the cards under the same switch",
+			policy:      furiosa_device.DualCorePolicy,
+			request:     6,
+			expected:    []string{"0_cores_0-1", "0_cores_2-3", "0_cores_4-5", "0_cores_6-7", "1_cores_0-1", "1_cores_2-3"},
+		},
+		{
+			description: "request the partitions of the card of the required partition",
+			policy:      furiosa_device.DualCorePolicy,
+			required:    []string{"5_cores_2-3"},
+			request:     3,
+			expected:    []string{"5_cores_0-1", "5_cores_2-3", "5_cores_4-5"},
+		},
+	})
+}
+
+// without returns every mock device partitioned with the policy except the given ones, which are allocated already.
+func without(policy furiosa_device.PartitioningPolicy, allocated ...string) []string {
+	var available []string
+	for _, device := range allDevices(policy) {
+		if !slices.Contains(allocated, device) {
+			available = append(available, device)
+		}
+	}
+
+	return available
+}
+
+func TestBranchAndBoundNpuAllocatorPartitions(t *testing.T) {
+	runAllocatorTests(t, config.BranchAndBoundAllocator, []allocatorTestCase{
+		{
+			description: "fill the partially used card with the fewest free partitions",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   without(furiosa_device.DualCorePolicy, "3_cores_0-1", "5_cores_0-1", "5_cores_2-3", "5_cores_4-5"),
+			request:     1,
+			expected:    []string{"5_cores_6-7"},
+		},
+		{
+			description: "fill the partially used card before the free cards",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   without(furiosa_device.DualCorePolicy, "2_cores_0-1", "2_cores_2-3"),
+			request:     2,
+			expected:    []string{"2_cores_4-5", "2_cores_6-7"},
+		},
+		{
+			description: "keep the partitions on a single card rather than filling the partially used card",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   without(furiosa_device.DualCorePolicy, "1_cores_0-1", "1_cores_2-3", "1_cores_4-5"),
+			request:     2,
+			expected:    []string{"0_cores_0-1", "0_cores_2-3"},
+		},
+		{
+			description: "cross the cards under the same switch of the partially used card",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   without(furiosa_device.DualCorePolicy, "1_cores_0-1", "1_cores_2-3"),
+			request:     6,
+			expected:    []string{"0_cores_0-1", "0_cores_2-3", "0_cores_4-5", "0_cores_6-7", "1_cores_4-5", "1_cores_6-7"},
+		},
+		{
+			description: "cross the partially used cards under the same switch",
+			policy:      furiosa_device.DualCorePolicy,
+			available:   []string{"4_cores_4-5", "4_cores_6-7", "5_cores_4-5", "5_cores_6-7", "6_cores_4-5", "6_cores_6-7"},
+			request:     3,
+			expected:    []string{"4_cores_4-5", "4_cores_6-7", "5_cores_4-5"},
+		},
+	})
+}
+
+// TestBranchAndBoundNpuAllocatorOptimal compares the score of the allocations with the exhaustive score-based allocator.
+func TestBranchAndBoundNpuAllocatorOptimal(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	topologyHintMatrix, err := npu_allocator.NewTopologyHintMatrix(mockDevices)
+	assert.NoError(t, err)
+	hintProvider := newTopologyHintProvider(topologyHintMatrix)
+
+	exhaustive, err := npu_allocator.NewScoreBasedOptimalNpuAllocator(mockDevices)
+	assert.NoError(t, err)
+	allocator, err := newBranchAndBoundNpuAllocator(mockDevices, furiosa_device.NonePolicy, 0)
+	assert.NoError(t, err)
+
+	var all []npu_allocator.Device
+	for _, device := range MockFuriosaDevices(mockDevices) {
+		all = append(all, npu_allocator.NewDevice(device))
+	}
+	available := npu_allocator.NewDeviceSet(all...)
+	devices := available.Devices()
+
+	for _, required := range [][]npu_allocator.Device{nil, {devices[3]}, {devices[0], devices[5]}} {
+		for request := max(len(required), 1); request <= len(devices); request++ {
+			t.Run(fmt.Sprintf("request %d devices with %d required", request, len(required)), func(t *testing.T) {
+				expected := exhaustive.Allocate(available, npu_allocator.NewDeviceSet(required...), request)
+				actual := allocator.Allocate(available, npu_allocator.NewDeviceSet(required...), request)
+
+				assert.Equal(t, request, actual.Len())
+				assert.True(t, actual.Contains(required...) || len(required) == 0)
+				assert.Equal(t, scoreOf(hintProvider, expected), scoreOf(hintProvider, actual))
+			})
+		}
+	}
+}
+
+// TestBranchAndBoundNpuAllocatorOptimalPartitions compares the score of the allocations of the partitioned cards with
+// the exhaustive score-based allocator, where the cards under the same switch are interchangeable.
+func TestBranchAndBoundNpuAllocatorOptimalPartitions(t *testing.T) {
+	available, hintProvider := syntheticTopology(8, 2)
+	devices := available.Devices()
+
+	tests := []struct {
+		description  string
+		hintProvider npu_allocator.TopologyHintProvider
+	}{
+		{
+			description:  "the partitions of a card score the highest",
+			hintProvider: hintProvider,
+		},
+		{
+			description: "the partitions of a card score lower than the other cards",
+			hintProvider: func(device1, device2 npu_allocator.Device) uint {
+				if device1.Index() == device2.Index() {
+					return 5
+				}
+				return hintProvider(device1, device2)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		exhaustive, _ := npu_allocator.NewMockScoreBasedOptimalNpuAllocator(tc.hintProvider)
+		allocator := &branchAndBoundNpuAllocator{hintProvider: tc.hintProvider, budget: time.Minute}
+
+		for _, required := range [][]npu_allocator.Device{nil, {devices[1]}, {devices[2], devices[3]}, {devices[4], devices[13]}} {
+			for request := max(len(required), 1); request <= 7; request++ {
+				t.Run(fmt.Sprintf("%s/request %d devices with %d required", tc.description, request, len(required)), func(t *testing.T) {
+					expected := exhaustive.Allocate(available, npu_allocator.NewDeviceSet(required...), request)
+					actual := allocator.Allocate(available, npu_allocator.NewDeviceSet(required...), request)
+
+					assert.Equal(t, request, actual.Len())
+					assert.Equal(t, scoreOf(tc.hintProvider, expected), scoreOf(tc.hintProvider, actual))
+
+					// the bound of the search can't be lower than the optimal score.
+					if len(required) == 0 {
+						s := allocator.newAllocationSearch(available, npu_allocator.NewDeviceSet())
+						assert.GreaterOrEqual(t, s.bound(0, request), scoreOf(tc.hintProvider, expected))
+					}
+				})
+			}
+		}
+	}
+}
+
+// syntheticTopology returns the devices of the cards with the partitions, and the link scores of a server with two
+// sockets, two PCIe switches per socket and the same number of the cards per switch.
+func syntheticTopology(cards int, partitions int) (npu_allocator.DeviceSet, npu_allocator.TopologyHintProvider) {
+	devices := npu_allocator.NewDeviceSet()
+	for card := 0; card < cards; card++ {
+		for partition := 0; partition < partitions; partition++ {
+			devices.Insert(npu_allocator.NewMockDevice(card, fmt.Sprintf("%d_cores_%d", card, partition), npu_allocator.TopologyHintKey(fmt.Sprintf("%03d", card))))
+		}
+	}
+
+	cardsPerSwitch := max(cards/4, 1)
+	hintProvider := func(device1, device2 npu_allocator.Device) uint {
+		card1, card2 := device1.Index(), device2.Index()
+		switch {
+		case card1 == card2:
+			return 70
+		case card1/cardsPerSwitch == card2/cardsPerSwitch:
+			return 30
+		case card1/(cardsPerSwitch*2) == card2/(cardsPerSwitch*2):
+			return 20
+		default:
+			return 10
+		}
+	}
+
+	return devices, hintProvider
+}
+
+func TestBranchAndBoundNpuAllocatorBudget(t *testing.T) {
+	available, hintProvider := syntheticTopology(16, 8)
+	required := npu_allocator.NewDeviceSet(available.Devices()[3], available.Devices()[100])
+
+	tests := []struct {
+		description string
+		budget      time.Duration
+		expired     bool
+	}{
+		{
+			description: "complete the search within the budget",
+			budget:      time.Minute,
+			expired:     false,
+		},
+		{
+			description: "complete the search without budget",
+			budget:      0,
+			expired:     false,
+		},
+		{
+			description: "fall back to the greedy allocation when the budget expires",
+			budget:      time.Nanosecond,
+			expired:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			allocator := &branchAndBoundNpuAllocator{hintProvider: hintProvider, budget: tc.budget}
+			expirations := testutil.ToFloat64(metrics.AllocationSearchExpirations)
+
+			for _, request := range []int{2, 12, 37, 64, 128} {
+				actual := allocator.Allocate(available, required, request)
+				assert.Equal(t, request, actual.Len())
+				assert.True(t, actual.Contains(required.Devices()...))
+
+				// the budget is spent before the search, so the greedy allocation is returned every time.
+				if tc.expired {
+					s := allocator.newAllocationSearch(available, required)
+					s.greedy(request-required.Len(), true)
+					assert.ElementsMatch(t, s.best(required).Devices(), actual.Devices())
+					assert.ElementsMatch(t, actual.Devices(), allocator.Allocate(available, required, request).Devices())
+				}
+			}
+			assert.Equal(t, tc.expired, testutil.ToFloat64(metrics.AllocationSearchExpirations) > expirations)
+
+			// the whole cards are preferred when nothing is required.
+			actual := allocator.Allocate(available, npu_allocator.NewDeviceSet(), 16)
+			assert.Equal(t, uint(2*28*70+64*30), scoreOf(hintProvider, actual))
+		})
+	}
+}
+
+func BenchmarkBranchAndBoundNpuAllocator(b *testing.B) {
+	for _, topology := range []struct {
+		cards      int
+		partitions int
+	}{
+		{cards: 8, partitions: 8},
+		{cards: 16, partitions: 8},
+	} {
+		available, hintProvider := syntheticTopology(topology.cards, topology.partitions)
+		allocator := &branchAndBoundNpuAllocator{hintProvider: hintProvider, budget: config.NewDefaultConfig().AllocationSearchBudget.Duration}
+		devices := available.Devices()
+
+		for _, request := range []int{1, 4, 8, 13, available.Len() / 4, available.Len() / 2} {
+			b.Run(fmt.Sprintf("%d devices/request %d", available.Len(), request), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					allocator.Allocate(available, npu_allocator.NewDeviceSet(), request)
+				}
+			})
+
+			// a required device breaks the symmetry of the cards.
+			b.Run(fmt.Sprintf("%d devices/request %d with required", available.Len(), request), func(b *testing.B) {
+				required := npu_allocator.NewDeviceSet(devices[len(devices)/3])
+				for i := 0; i < b.N; i++ {
+					allocator.Allocate(available, required, request)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package device_manager
+
+import (
+	"sort"
+
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/cdi_spec_gen"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	devicePluginAPIv1Beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	"tags.cncf.io/container-device-interface/pkg/parser"
+)
+
+const (
+	// cdiVendor and cdiClass must match the kind of the spec generated by cdi_spec_gen.
+	cdiVendor = "furiosa.ai"
+	cdiClass  = "npu"
+)
+
+// cdiDeviceName returns the fully qualified CDI device name of the device, e.g. "furiosa.ai/npu=<uuid>".
+func cdiDeviceName(deviceID string) string {
+	return parser.QualifiedName(cdiVendor, cdiClass, deviceID)
+}
+
+// NewCDISpec builds the CDI spec having a CDI device per FuriosaDevice, which is written to the spec dir.
+// The CDI devices are named after the device ids since the partitions of a card share the name of the card.
+func NewCDISpec(specDir string, devices ...furiosa_device.FuriosaDevice) (cdi_spec_gen.Spec, error) {
+	sorted := make([]furiosa_device.FuriosaDevice, len(devices))
+	copy(sorted, devices)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DeviceID() < sorted[j].DeviceID()
+	})
+
+	spec, err := cdi_spec_gen.NewSpec(cdi_spec_gen.WithSpecDirs(specDir), cdi_spec_gen.WithDevices(sorted...))
+	if err != nil {
+		return nil, err
+	}
+
+	// cdi_spec_gen keeps the order of the devices.
+	raw := spec.Raw()
+	for i := range raw.Devices {
+		raw.Devices[i].Name = sorted[i].DeviceID()
+	}
+
+	return spec, nil
+}
+
+func buildCDIDevicesToContainerAllocateResponse(resp *devicePluginAPIv1Beta1.ContainerAllocateResponse, devices ...furiosa_device.FuriosaDevice) {
+	for _, device := range devices {
+		resp.CdiDevices = append(resp.CdiDevices, &devicePluginAPIv1Beta1.CDIDevice{Name: cdiDeviceName(device.DeviceID())})
+	}
+}
@@ -0,0 +1,111 @@
+package device_manager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/cdi_spec_gen"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+	"tags.cncf.io/container-device-interface/pkg/cdi"
+
+	devicePluginAPIv1Beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestNewCDISpec(t *testing.T) {
+	tests := []struct {
+		description   string
+		policy        furiosa_device.PartitioningPolicy
+		expectedCount int
+		expectedName  string
+	}{
+		{
+			description:   "a cdi device per card",
+			policy:        furiosa_device.NonePolicy,
+			expectedCount: 8,
+			expectedName:  "furiosa.ai/npu=A76AAD68-6855-40B1-9E86-D080852D1C81",
+		},
+		{
+			description:   "a cdi device per partition",
+			policy:        furiosa_device.DualCorePolicy,
+			expectedCount: 32,
+			expectedName:  "furiosa.ai/npu=A76AAD68-6855-40B1-9E86-D080852D1C81_cores_2-3",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			furiosaDevices, err := furiosa_device.NewFuriosaDevices(smi.GetStaticMockDevices(smi.ArchRngd), nil, tc.policy)
+			assert.NoError(t, err)
+
+			specDir := t.TempDir()
+			spec, err := NewCDISpec(specDir, furiosaDevices...)
+			assert.NoError(t, err)
+			assert.Len(t, spec.Raw().Devices, tc.expectedCount)
+			assert.NoError(t, spec.Write())
+			assert.FileExists(t, filepath.Join(specDir, cdi_spec_gen.DefaultSpecFileName))
+
+			// the container runtime must be able to resolve every CDI device returned by Allocate.
+			cache, err := cdi.NewCache(cdi.WithSpecDirs(specDir), cdi.WithAutoRefresh(false))
+			assert.NoError(t, err)
+			assert.Empty(t, cache.GetErrors())
+			for _, furiosaDevice := range furiosaDevices {
+				assert.NotNil(t, cache.GetDevice(cdiDeviceName(furiosaDevice.DeviceID())))
+			}
+			assert.NotNil(t, cache.GetDevice(tc.expectedName))
+		})
+	}
+}
+
+func TestGetContainerAllocateResponseWithDeviceInjection(t *testing.T) {
+	tests := []struct {
+		description        string
+		deviceInjection    config.DeviceInjectionMode
+		expectedDevices    bool
+		expectedCDIDevices []*devicePluginAPIv1Beta1.CDIDevice
+	}{
+		{
+			description:        "legacy",
+			deviceInjection:    config.LegacyDeviceInjection,
+			expectedDevices:    true,
+			expectedCDIDevices: nil,
+		},
+		{
+			description:     "cdi",
+			deviceInjection: config.CDIDeviceInjection,
+			expectedDevices: false,
+			expectedCDIDevices: []*devicePluginAPIv1Beta1.CDIDevice{
+				{Name: "furiosa.ai/npu=A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3"},
+				{Name: "furiosa.ai/npu=A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-7"},
+			},
+		},
+		{
+			description:     "both",
+			deviceInjection: config.BothDeviceInjection,
+			expectedDevices: true,
+			expectedCDIDevices: []*devicePluginAPIv1Beta1.CDIDevice{
+				{Name: "furiosa.ai/npu=A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3"},
+				{Name: "furiosa.ai/npu=A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-7"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := config.NewDefaultConfig()
+			cfg.DeviceInjection = tc.deviceInjection
+			manager, err := NewDeviceManager("furiosa.ai/rngd-4core", furiosa_device.QuadCorePolicy, smi.GetStaticMockDevices(smi.ArchRngd), nil, cfg)
+			assert.NoError(t, err)
+
+			actual, err := manager.GetContainerAllocateResponse([]string{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3",
+				"A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-7",
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDevices, len(actual.Devices) > 0)
+			assert.Equal(t, tc.expectedCDIDevices, actual.CdiDevices)
+		})
+	}
+}
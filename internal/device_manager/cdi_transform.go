@@ -25,10 +25,18 @@ func buildDeviceSpecToContainerAllocateResponse(devices ...furiosa_device.Furios
 	return resp, nil
 }
 
+// transformDeviceNodes flattens device nodes of the given CDI devices.
+// Partitions of the same card share device nodes such as mgmt, channels and bars, so duplicated container paths are dropped.
 func transformDeviceNodes(devices []specs.Device) []*devicePluginAPIv1Beta1.DeviceSpec {
 	var out []*devicePluginAPIv1Beta1.DeviceSpec
+	visited := make(map[string]struct{})
 	for _, device := range devices {
 		for _, node := range device.ContainerEdits.DeviceNodes {
+			if _, exist := visited[node.Path]; exist {
+				continue
+			}
+			visited[node.Path] = struct{}{}
+
 			out = append(out, &devicePluginAPIv1Beta1.DeviceSpec{
 				HostPath:      node.HostPath,
 				ContainerPath: node.Path,
@@ -42,8 +50,14 @@ func transformDeviceNodes(devices []specs.Device) []*devicePluginAPIv1Beta1.Devi
 
 func transformMounts(devices []specs.Device) []*devicePluginAPIv1Beta1.Mount {
 	var out []*devicePluginAPIv1Beta1.Mount
+	visited := make(map[string]struct{})
 	for _, device := range devices {
 		for _, mount := range device.ContainerEdits.Mounts {
+			if _, exist := visited[mount.ContainerPath]; exist {
+				continue
+			}
+			visited[mount.ContainerPath] = struct{}{}
+
 			out = append(out, &devicePluginAPIv1Beta1.Mount{
 				HostPath:      mount.HostPath,
 				ContainerPath: mount.ContainerPath,
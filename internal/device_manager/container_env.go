@@ -0,0 +1,126 @@
+package device_manager
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+)
+
+// The environment variables describing the allocated devices.
+// The lists are comma separated and aligned with FURIOSA_DEVICE_IDS, so that the n-th elements describe the same device.
+const (
+	DeviceIDsEnv       = "FURIOSA_DEVICE_IDS"
+	DeviceUUIDsEnv     = "FURIOSA_DEVICE_UUIDS"
+	DeviceIndicesEnv   = "FURIOSA_DEVICE_INDICES"
+	DevicePECoresEnv   = "FURIOSA_DEVICE_PE_CORES"
+	DeviceNUMANodesEnv = "FURIOSA_DEVICE_NUMA_NODES"
+	DeviceArchEnv      = "FURIOSA_DEVICE_ARCH"
+)
+
+// ContainerEnvData is the data rendering the templates of config.ContainerEnv.
+type ContainerEnvData struct {
+	ResourceName string
+	// Arch is the architecture of the devices, the distinct architectures are comma separated if the resource has several.
+	Arch string
+	// Devices are ordered by the index of the card and the PE cores.
+	Devices []AllocatedDevice
+}
+
+// DeviceIDs returns the ids of the devices, the other lists of the devices are aligned with it.
+func (c ContainerEnvData) DeviceIDs() []string {
+	return c.collect(func(d AllocatedDevice) string { return d.ID })
+}
+
+// UUIDs returns the card uuids of the devices.
+func (c ContainerEnvData) UUIDs() []string {
+	return c.collect(func(d AllocatedDevice) string { return d.UUID })
+}
+
+// Indices returns the card indices of the devices.
+func (c ContainerEnvData) Indices() []string {
+	return c.collect(func(d AllocatedDevice) string { return strconv.FormatUint(uint64(d.Index), 10) })
+}
+
+// PECores returns the PE core ranges of the devices.
+func (c ContainerEnvData) PECores() []string {
+	return c.collect(AllocatedDevice.PECores)
+}
+
+// NUMANodes returns the NUMA nodes of the devices.
+func (c ContainerEnvData) NUMANodes() []string {
+	return c.collect(func(d AllocatedDevice) string { return strconv.Itoa(d.NUMANode) })
+}
+
+func (c ContainerEnvData) collect(fn func(AllocatedDevice) string) []string {
+	ret := make([]string, 0, len(c.Devices))
+	for _, device := range c.Devices {
+		ret = append(ret, fn(device))
+	}
+
+	return ret
+}
+
+// containerEnvTemplate is a config.ContainerEnv selecting the resource of DeviceManager.
+type containerEnvTemplate struct {
+	name     string
+	template *template.Template
+}
+
+// newContainerEnvTemplates parses the templates of the container envs selecting the resource.
+func newContainerEnvTemplates(resourceName string, envs []config.ContainerEnv) ([]containerEnvTemplate, error) {
+	var templates []containerEnvTemplate
+	for _, env := range envs {
+		if !env.Selects(resourceName) {
+			continue
+		}
+
+		tmpl, err := env.Template()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse container env %s: %w", env.Name, err)
+		}
+
+		templates = append(templates, containerEnvTemplate{name: env.Name, template: tmpl})
+	}
+
+	return templates, nil
+}
+
+// buildContainerEnvs returns the environment variables describing the allocated devices followed by the configured ones,
+// a configured environment variable overrides the one with the same name.
+func (d *deviceManager) buildContainerEnvs(devices []AllocatedDevice) (map[string]string, error) {
+	data := ContainerEnvData{ResourceName: d.resourceName, Arch: distinctArchs(devices), Devices: devices}
+	envs := map[string]string{
+		DeviceIDsEnv:       strings.Join(data.DeviceIDs(), ","),
+		DeviceUUIDsEnv:     strings.Join(data.UUIDs(), ","),
+		DeviceIndicesEnv:   strings.Join(data.Indices(), ","),
+		DevicePECoresEnv:   strings.Join(data.PECores(), ","),
+		DeviceNUMANodesEnv: strings.Join(data.NUMANodes(), ","),
+		DeviceArchEnv:      data.Arch,
+	}
+
+	for _, env := range d.containerEnvs {
+		var buf bytes.Buffer
+		if err := env.template.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("couldn't render container env %s: %w", env.name, err)
+		}
+		envs[env.name] = buf.String()
+	}
+
+	return envs, nil
+}
+
+func distinctArchs(devices []AllocatedDevice) string {
+	var archs []string
+	for _, device := range devices {
+		if !slices.Contains(archs, device.Arch) {
+			archs = append(archs, device.Arch)
+		}
+	}
+
+	return strings.Join(archs, ",")
+}
@@ -0,0 +1,86 @@
+package device_manager
+
+import (
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerAllocateResponseEnvs(t *testing.T) {
+	tests := []struct {
+		description   string
+		containerEnvs []config.ContainerEnv
+		deviceIDs     []string
+		expectedEnvs  map[string]string
+		expectError   bool
+	}{
+		{
+			description: "partitions of multiple cards are ordered by the card and the PE cores",
+			deviceIDs: []string{
+				"A76AAD68-6855-40B1-9E86-D080852D1C84_cores_4-7",
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7",
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3",
+			},
+			expectedEnvs: map[string]string{
+				"FURIOSA_DEVICE_IDS":        "A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3,A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7,A76AAD68-6855-40B1-9E86-D080852D1C84_cores_4-7",
+				"FURIOSA_DEVICE_UUIDS":      "A76AAD68-6855-40B1-9E86-D080852D1C80,A76AAD68-6855-40B1-9E86-D080852D1C80,A76AAD68-6855-40B1-9E86-D080852D1C84",
+				"FURIOSA_DEVICE_INDICES":    "0,0,4",
+				"FURIOSA_DEVICE_PE_CORES":   "0-3,4-7,4-7",
+				"FURIOSA_DEVICE_NUMA_NODES": "0,0,1",
+				"FURIOSA_DEVICE_ARCH":       "rngd",
+			},
+		},
+		{
+			description: "static and templated envs",
+			containerEnvs: []config.ContainerEnv{
+				{Name: "NPU_QUEUE", Value: "inference"},
+				{Name: "NPU_DEVICES", Value: `{{ range $i, $d := .Devices }}{{ if $i }} {{ end }}npu{{ $d.Index }}pe{{ $d.PECores }}{{ end }}`},
+				{Name: "NPU_RESOURCE", Value: "{{ .ResourceName }}", Resources: []string{"furiosa.ai/rngd-4core"}},
+				{Name: "NPU_UNSELECTED", Value: "unselected", Resources: []string{"furiosa.ai/rngd"}},
+				{Name: "FURIOSA_DEVICE_UUIDS", Value: `{{ join ";" .UUIDs }}`},
+			},
+			deviceIDs: []string{
+				"A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-7",
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3",
+			},
+			expectedEnvs: map[string]string{
+				"FURIOSA_DEVICE_IDS":        "A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3,A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-7",
+				"FURIOSA_DEVICE_UUIDS":      "A76AAD68-6855-40B1-9E86-D080852D1C80;A76AAD68-6855-40B1-9E86-D080852D1C81",
+				"FURIOSA_DEVICE_INDICES":    "0,1",
+				"FURIOSA_DEVICE_PE_CORES":   "0-3,4-7",
+				"FURIOSA_DEVICE_NUMA_NODES": "0,0",
+				"FURIOSA_DEVICE_ARCH":       "rngd",
+				"NPU_QUEUE":                 "inference",
+				"NPU_DEVICES":               "npu0pe0-3 npu1pe4-7",
+				"NPU_RESOURCE":              "furiosa.ai/rngd-4core",
+			},
+		},
+		{
+			description:   "template referring to an unknown field",
+			containerEnvs: []config.ContainerEnv{{Name: "NPU_SERIALS", Value: "{{ .Serials }}"}},
+			deviceIDs:     []string{"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3"},
+			expectError:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := config.NewDefaultConfig()
+			cfg.ContainerEnvs = tc.containerEnvs
+			manager, err := NewDeviceManager("furiosa.ai/rngd-4core", furiosa_device.QuadCorePolicy, smi.GetStaticMockDevices(smi.ArchRngd), nil, cfg)
+			assert.NoError(t, err)
+
+			actual, err := manager.GetContainerAllocateResponse(tc.deviceIDs)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedEnvs, actual.Envs)
+		})
+	}
+}
@@ -1,34 +1,153 @@
 package device_manager
 
 import (
+	"fmt"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
 	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
 	"github.com/rs/zerolog"
 )
 
-type DeviceMap map[smi.Arch][]smi.Device
+// DeviceGroupKey identifies a set of devices exposed under a single resource name.
+// The devices may have different architectures if config.ResourceNameConfig exposes them under the same resource name.
+type DeviceGroupKey struct {
+	ResourceName string
+	Policy       furiosa_device.PartitioningPolicy
+}
+
+type DeviceMap map[DeviceGroupKey][]smi.Device
 
-func BuildDeviceMap(logger zerolog.Logger) (DeviceMap, error) {
+// UnknownArchDevice is a card of an architecture unknown to the device plugin.
+type UnknownArchDevice struct {
+	UUID string   `json:"uuid"`
+	BDF  string   `json:"bdf"`
+	Arch smi.Arch `json:"arch"`
+	// ResourceName is the fallback resource of the card, the card is skipped if it is empty.
+	ResourceName string `json:"resourceName,omitempty"`
+}
+
+// FailedDevice is a card whose information couldn't be read, the card isn't exposed under any resource.
+type FailedDevice struct {
+	// Position is the position of the card in the devices listed by the driver, the index of the card is unknown.
+	Position int    `json:"position"`
+	Error    string `json:"error"`
+}
+
+// Discovery is the result of BuildDeviceMap.
+type Discovery struct {
+	DeviceMap          DeviceMap
+	UnknownArchDevices []UnknownArchDevice
+	FailedDevices      []FailedDevice
+}
+
+// BuildDeviceMap groups the cards by the resource, and returns the cards of unknown architectures and the cards
+// which couldn't be read separately.
+func BuildDeviceMap(logger zerolog.Logger, cfg *config.Config) (Discovery, error) {
 	err := smi.Init()
 	if err != nil {
-		return nil, err
+		return Discovery{}, err
+	}
+
+	devices, err := smi.ListDevices()
+	if err != nil {
+		return Discovery{}, err
 	}
 
+	return buildDeviceMap(logger, devices, cfg)
+}
+
+// RebuildDeviceMap lists the cards again after BuildDeviceMap, e.g. to find the cards hot-plugged, enabled or disabled.
+func RebuildDeviceMap(logger zerolog.Logger, cfg *config.Config) (Discovery, error) {
 	devices, err := smi.ListDevices()
 	if err != nil {
-		return nil, err
+		return Discovery{}, err
 	}
 
-	archToDevicesMap := make(DeviceMap)
-	for _, d := range devices {
+	return buildDeviceMap(logger, devices, cfg)
+}
+
+func buildDeviceMap(logger zerolog.Logger, devices []smi.Device, cfg *config.Config) (Discovery, error) {
+	deviceMap := make(DeviceMap)
+	var unknownArchDevices []UnknownArchDevice
+	var failedDevices []FailedDevice
+
+	for position, d := range devices {
 		info, err := d.DeviceInfo()
 		if err != nil {
-			logger.Err(err).Msg("failed to get device info for some device")
+			// a card which can't be read is skipped so that the other cards are still served.
+			logger.Err(err).Msg(fmt.Sprintf("couldn't get device info of the device at position %d, the device is skipped", position))
+			failedDevices = append(failedDevices, FailedDevice{Position: position, Error: err.Error()})
+			continue
+		}
+
+		policy, err := resolvePartitioningPolicy(info, cfg)
+		if err != nil {
+			return Discovery{}, err
+		}
+
+		var resourceName string
+		if isKnownArch(info.Arch()) {
+			resourceName, err = resolveResourceName(info.Arch(), policy, cfg)
+		} else {
+			resourceName, err = resolveUnknownArchResourceName(policy, cfg)
+			unknownArchDevices = append(unknownArchDevices, UnknownArchDevice{
+				UUID:         info.UUID(),
+				BDF:          info.BDF(),
+				Arch:         info.Arch(),
+				ResourceName: resourceName,
+			})
+		}
+
+		if err != nil {
+			return Discovery{}, err
+		}
+
+		// a card of an unknown architecture is skipped without the fallback resource.
+		if resourceName == "" {
+			continue
+		}
+
+		key := DeviceGroupKey{ResourceName: resourceName, Policy: policy}
+		deviceMap[key] = append(deviceMap[key], d)
+	}
+
+	// the devices of a resource must be interchangeable, so a resource can't have partitions of different sizes.
+	policies := make(map[string]furiosa_device.PartitioningPolicy)
+	for key := range deviceMap {
+		if policy, exist := policies[key.ResourceName]; exist {
+			return Discovery{}, fmt.Errorf("resource %s has devices partitioned with both %s and %s policies", key.ResourceName, policy, key.Policy)
+		}
+		policies[key.ResourceName] = key.Policy
+	}
+
+	return Discovery{DeviceMap: deviceMap, UnknownArchDevices: unknownArchDevices, FailedDevices: failedDevices}, nil
+}
+
+// resolvePartitioningPolicy picks the partitioning policy of the device in the order of
+// config.PartitioningGroup, per-arch policy and the default policy.
+func resolvePartitioningPolicy(info smi.DeviceInfo, cfg *config.Config) (furiosa_device.PartitioningPolicy, error) {
+	var matchedGroup *config.PartitioningGroup
+	var matchedSelector string
+
+	for i := range cfg.PartitioningGroups {
+		group := &cfg.PartitioningGroups[i]
+		selector, matched := matchAnyDevice(info, group.Devices)
+		if !matched {
 			continue
 		}
 
-		key := info.Arch()
-		archToDevicesMap[key] = append(archToDevicesMap[key], d)
+		if matchedGroup != nil {
+			return "", fmt.Errorf("device %s is selected by multiple partitioning groups with selectors %s and %s", info.UUID(), matchedSelector, selector)
+		}
+
+		matchedGroup = group
+		matchedSelector = selector
+	}
+
+	if matchedGroup != nil {
+		return matchedGroup.Policy, nil
 	}
 
-	return archToDevicesMap, nil
+	return cfg.PartitioningPolicyFor(info.Arch().ToString()), nil
 }
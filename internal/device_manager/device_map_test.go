@@ -0,0 +1,269 @@
+package device_manager
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func deviceIndices(devices []smi.Device) []uint32 {
+	var ret []uint32
+	for _, d := range devices {
+		info, _ := d.DeviceInfo()
+		ret = append(ret, info.Index())
+	}
+
+	return ret
+}
+
+// archDevice is a mock device reporting the given arch, the static mock devices are available only for rngd.
+type archDevice struct {
+	smi.Device
+	arch smi.Arch
+}
+
+func (a archDevice) DeviceInfo() (smi.DeviceInfo, error) {
+	info, err := a.Device.DeviceInfo()
+	return archDeviceInfo{DeviceInfo: info, arch: a.arch}, err
+}
+
+type archDeviceInfo struct {
+	smi.DeviceInfo
+	arch smi.Arch
+}
+
+func (a archDeviceInfo) Arch() smi.Arch {
+	return a.arch
+}
+
+// mixedArchDevices returns rngd cards 0-3 and rngd-max cards 4-7.
+func mixedArchDevices() []smi.Device {
+	devices := smi.GetStaticMockDevices(smi.ArchRngd)
+	for i := 4; i < len(devices); i++ {
+		devices[i] = archDevice{Device: devices[i], arch: smi.ArchRngdMax}
+	}
+
+	return devices
+}
+
+// unknownArchDevices returns rngd cards 0-5 and cards 6-7 of an unknown arch.
+func unknownArchDevices() []smi.Device {
+	devices := smi.GetStaticMockDevices(smi.ArchRngd)
+	for i := 6; i < len(devices); i++ {
+		devices[i] = archDevice{Device: devices[i], arch: smi.Arch(99)}
+	}
+
+	return devices
+}
+
+// failingDevice is a mock device whose information can't be read.
+type failingDevice struct {
+	smi.Device
+}
+
+func (f failingDevice) DeviceInfo() (smi.DeviceInfo, error) {
+	return nil, fmt.Errorf("device is not responding")
+}
+
+// failingDevices returns rngd cards whose information can't be read at the given positions.
+func failingDevices(positions ...int) []smi.Device {
+	devices := smi.GetStaticMockDevices(smi.ArchRngd)
+	for _, position := range positions {
+		devices[position] = failingDevice{Device: devices[position]}
+	}
+
+	return devices
+}
+
+func TestBuildDeviceMap(t *testing.T) {
+	tests := []struct {
+		description         string
+		devices             []smi.Device
+		mutate              func(c *config.Config)
+		expectedResult      map[DeviceGroupKey][]uint32
+		expectedUnknownArch []UnknownArchDevice
+		expectedFailed      []FailedDevice
+		expectError         bool
+	}{
+		{
+			description: "group every device by arch with the default policy",
+			mutate:      func(c *config.Config) {},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/rngd", Policy: furiosa_device.NonePolicy}: {0, 1, 2, 3, 4, 5, 6, 7},
+			},
+			expectError: false,
+		},
+		{
+			description: "group every device by arch with the per-arch policy",
+			mutate: func(c *config.Config) {
+				c.ArchPartitioningPolicies = map[string]furiosa_device.PartitioningPolicy{"rngd": furiosa_device.DualCorePolicy}
+			},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/rngd-2core", Policy: furiosa_device.DualCorePolicy}: {0, 1, 2, 3, 4, 5, 6, 7},
+			},
+			expectError: false,
+		},
+		{
+			description: "split cards by index, uuid and bdf",
+			mutate: func(c *config.Config) {
+				c.PartitioningGroups = []config.PartitioningGroup{
+					{Policy: furiosa_device.DualCorePolicy, Devices: []string{"2", "3", "a76aad68-6855-40b1-9e86-d080852d1c84", "0000:A4:00.0"}},
+					{Policy: furiosa_device.SingleCorePolicy, Devices: []string{"6", "7"}},
+				}
+			},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/rngd", Policy: furiosa_device.NonePolicy}:             {0, 1},
+				{ResourceName: "furiosa.ai/rngd-2core", Policy: furiosa_device.DualCorePolicy}:   {2, 3, 4, 5},
+				{ResourceName: "furiosa.ai/rngd-1core", Policy: furiosa_device.SingleCorePolicy}: {6, 7},
+			},
+			expectError: false,
+		},
+		{
+			description: "custom resource name and domain",
+			mutate: func(c *config.Config) {
+				c.ResourceNames = []config.ResourceNameConfig{
+					{Archs: []string{"rngd"}, Policy: furiosa_device.QuadCorePolicy, Domain: "acme.com", Name: "npu-large"},
+				}
+				c.PartitioningGroups = []config.PartitioningGroup{
+					{Policy: furiosa_device.QuadCorePolicy, Devices: []string{"0", "1"}},
+				}
+			},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "acme.com/npu-large", Policy: furiosa_device.QuadCorePolicy}: {0, 1},
+				{ResourceName: "furiosa.ai/rngd", Policy: furiosa_device.NonePolicy}:        {2, 3, 4, 5, 6, 7},
+			},
+			expectError: false,
+		},
+		{
+			description: "several archs under a single resource name",
+			devices:     mixedArchDevices(),
+			mutate: func(c *config.Config) {
+				c.ResourceNames = []config.ResourceNameConfig{{Archs: []string{"rngd", "rngd-max"}, Name: "npu"}}
+				c.PartitioningGroups = []config.PartitioningGroup{
+					{Policy: furiosa_device.DualCorePolicy, Devices: []string{"2", "6"}},
+				}
+			},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/npu", Policy: furiosa_device.NonePolicy}:           {0, 1, 3, 4, 5, 7},
+				{ResourceName: "furiosa.ai/npu-2core", Policy: furiosa_device.DualCorePolicy}: {2, 6},
+			},
+			expectError: false,
+		},
+		{
+			description: "resource name selected by the exact policy takes precedence",
+			devices:     mixedArchDevices(),
+			mutate: func(c *config.Config) {
+				c.ResourceNames = []config.ResourceNameConfig{
+					{Archs: []string{"rngd-max"}, Policy: furiosa_device.NonePolicy, Name: "npu-max"},
+					{Archs: []string{"rngd", "rngd-max"}, Name: "npu"},
+				}
+			},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/npu", Policy: furiosa_device.NonePolicy}:     {0, 1, 2, 3},
+				{ResourceName: "furiosa.ai/npu-max", Policy: furiosa_device.NonePolicy}: {4, 5, 6, 7},
+			},
+			expectError: false,
+		},
+		{
+			description: "reject a resource name with different partitioning policies",
+			devices:     mixedArchDevices(),
+			mutate: func(c *config.Config) {
+				c.ResourceNames = []config.ResourceNameConfig{
+					{Archs: []string{"rngd"}, Policy: furiosa_device.NonePolicy, Name: "npu"},
+					{Archs: []string{"rngd-max"}, Policy: furiosa_device.DualCorePolicy, Name: "npu"},
+				}
+				c.ArchPartitioningPolicies = map[string]furiosa_device.PartitioningPolicy{"rngd-max": furiosa_device.DualCorePolicy}
+			},
+			expectedResult: nil,
+			expectError:    true,
+		},
+		{
+			description: "skip unknown archs",
+			devices:     unknownArchDevices(),
+			mutate:      func(c *config.Config) {},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/rngd", Policy: furiosa_device.NonePolicy}: {0, 1, 2, 3, 4, 5},
+			},
+			expectedUnknownArch: []UnknownArchDevice{
+				{UUID: "A76AAD68-6855-40B1-9E86-D080852D1C86", BDF: "0000:c7:00.0", Arch: smi.Arch(99)},
+				{UUID: "A76AAD68-6855-40B1-9E86-D080852D1C87", BDF: "0000:ca:00.0", Arch: smi.Arch(99)},
+			},
+			expectError: false,
+		},
+		{
+			description: "register unknown archs under the fallback resource",
+			devices:     unknownArchDevices(),
+			mutate: func(c *config.Config) {
+				c.UnknownArch.ResourceName = "npu-unknown"
+				c.ResourceNames = []config.ResourceNameConfig{{Archs: []string{"rngd"}, Name: "npu-unknown"}}
+			},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/npu-unknown", Policy: furiosa_device.NonePolicy}: {0, 1, 2, 3, 4, 5, 6, 7},
+			},
+			expectedUnknownArch: []UnknownArchDevice{
+				{UUID: "A76AAD68-6855-40B1-9E86-D080852D1C86", BDF: "0000:c7:00.0", Arch: smi.Arch(99), ResourceName: "furiosa.ai/npu-unknown"},
+				{UUID: "A76AAD68-6855-40B1-9E86-D080852D1C87", BDF: "0000:ca:00.0", Arch: smi.Arch(99), ResourceName: "furiosa.ai/npu-unknown"},
+			},
+			expectError: false,
+		},
+		{
+			description: "skip the cards whose information can't be read",
+			devices:     failingDevices(1, 5),
+			mutate:      func(c *config.Config) {},
+			expectedResult: map[DeviceGroupKey][]uint32{
+				{ResourceName: "furiosa.ai/rngd", Policy: furiosa_device.NonePolicy}: {0, 2, 3, 4, 6, 7},
+			},
+			expectedFailed: []FailedDevice{
+				{Position: 1, Error: "device is not responding"},
+				{Position: 5, Error: "device is not responding"},
+			},
+			expectError: false,
+		},
+		{
+			description: "reject a card selected by multiple groups",
+			mutate: func(c *config.Config) {
+				c.PartitioningGroups = []config.PartitioningGroup{
+					{Policy: furiosa_device.DualCorePolicy, Devices: []string{"0"}},
+					{Policy: furiosa_device.SingleCorePolicy, Devices: []string{"0000:27:00.0"}},
+				}
+			},
+			expectedResult: nil,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := config.NewDefaultConfig()
+			tc.mutate(cfg)
+
+			devices := tc.devices
+			if devices == nil {
+				devices = smi.GetStaticMockDevices(smi.ArchRngd)
+			}
+
+			actual, actualErr := buildDeviceMap(zerolog.New(io.Discard), devices, cfg)
+			if tc.expectError {
+				assert.Error(t, actualErr)
+				return
+			}
+
+			assert.NoError(t, actualErr)
+
+			actualIndices := make(map[DeviceGroupKey][]uint32)
+			for key, devices := range actual.DeviceMap {
+				actualIndices[key] = deviceIndices(devices)
+			}
+
+			assert.Equal(t, tc.expectedResult, actualIndices)
+			assert.Equal(t, tc.expectedUnknownArch, actual.UnknownArchDevices)
+			assert.Equal(t, tc.expectedFailed, actual.FailedDevices)
+		})
+	}
+}
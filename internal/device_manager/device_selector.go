@@ -0,0 +1,38 @@
+package device_manager
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+)
+
+// matchDevice reports whether the given selector points the device by UUID, serial, PCI BDF or index.
+// UUID, serial and BDF are compared case-insensitively.
+func matchDevice(info smi.DeviceInfo, selector string) bool {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return false
+	}
+
+	if strings.EqualFold(selector, info.UUID()) || strings.EqualFold(selector, info.Serial()) || strings.EqualFold(selector, info.BDF()) {
+		return true
+	}
+
+	if index, err := strconv.ParseUint(selector, 10, 32); err == nil && uint32(index) == info.Index() {
+		return true
+	}
+
+	return false
+}
+
+// matchAnyDevice returns the first selector pointing the device.
+func matchAnyDevice(info smi.DeviceInfo, selectors []string) (string, bool) {
+	for _, selector := range selectors {
+		if matchDevice(info, selector) {
+			return selector, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,194 @@
+package device_manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+)
+
+const (
+	healthyExp   = "healthy"
+	unhealthyExp = "unhealthy"
+)
+
+// HealthState is the last known health of a device.
+type HealthState struct {
+	Healthy bool
+	// Reason explains why the device is unhealthy, it is empty for healthy devices.
+	Reason string
+	// LastChecked is the time of the latest health check.
+	LastChecked time.Time
+	// LastTransition is the time the device entered the current state.
+	LastTransition time.Time
+	// QuarantinedUntil is the time until the device is kept unhealthy because of flapping.
+	QuarantinedUntil time.Time
+}
+
+func (s HealthState) String() string {
+	if s.Healthy {
+		return healthyExp
+	}
+
+	return unhealthyExp
+}
+
+// HealthEvent describes a health transition of a device.
+type HealthEvent struct {
+	DeviceID string
+	Previous HealthState
+	Current  HealthState
+}
+
+func (e HealthEvent) String() string {
+	if e.Current.Healthy {
+		return fmt.Sprintf("device %s became %s after %s", e.DeviceID, e.Current, e.Current.LastTransition.Sub(e.Previous.LastTransition))
+	}
+
+	return fmt.Sprintf("device %s became %s: %s", e.DeviceID, e.Current, e.Current.Reason)
+}
+
+// healthTracker keeps the last known health of devices, it is safe for concurrent use.
+// The reported health follows the observed health with the hysteresis, a zero hysteresis follows every change.
+type healthTracker struct {
+	mu         sync.RWMutex
+	now        func() time.Time
+	hysteresis config.HealthHysteresisConfig
+	states     map[string]HealthState
+	histories  map[string]*healthHistory
+}
+
+// healthHistory is the recent observations of a device used for the hysteresis.
+type healthHistory struct {
+	consecutiveFailures  int
+	consecutiveSuccesses int
+	// flaps are the times the device became unhealthy within the quarantine window.
+	flaps []time.Time
+}
+
+// update records the result of a health check and returns the transition if the reported health of the device is changed.
+// The first observation of a device is reported as is and is not a transition.
+func (h *healthTracker) update(deviceID string, healthy bool, reason string) (HealthEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.states == nil {
+		h.states = make(map[string]HealthState)
+		h.histories = make(map[string]*healthHistory)
+	}
+
+	now := time.Now()
+	if h.now != nil {
+		now = h.now()
+	}
+
+	previous, exist := h.states[deviceID]
+	if !exist {
+		h.states[deviceID] = HealthState{Healthy: healthy, Reason: reason, LastChecked: now, LastTransition: now}
+		h.histories[deviceID] = &healthHistory{}
+		return HealthEvent{}, false
+	}
+
+	history := h.histories[deviceID]
+	if healthy {
+		history.consecutiveSuccesses++
+		history.consecutiveFailures = 0
+	} else {
+		history.consecutiveFailures++
+		history.consecutiveSuccesses = 0
+	}
+
+	current := previous
+	current.LastChecked = now
+
+	switch {
+	case previous.Healthy && !healthy && history.consecutiveFailures >= max(h.hysteresis.FailureThreshold, 1):
+		current.Healthy = false
+		current.Reason = reason
+		current.LastTransition = now
+		h.recordFlap(history, &current, now)
+
+	case !previous.Healthy && !healthy:
+		current.Reason = reason
+
+	case !previous.Healthy && healthy:
+		switch {
+		case now.Before(current.QuarantinedUntil):
+			current.Reason = fmt.Sprintf("quarantined until %s after %d flaps", current.QuarantinedUntil.Format(time.RFC3339), len(history.flaps))
+		case history.consecutiveSuccesses < max(h.hysteresis.SuccessThreshold, 1):
+			current.Reason = fmt.Sprintf("recovering, %d of %d successful checks", history.consecutiveSuccesses, h.hysteresis.SuccessThreshold)
+		default:
+			current.Healthy = true
+			current.Reason = ""
+			current.QuarantinedUntil = time.Time{}
+			current.LastTransition = now
+		}
+	}
+
+	h.states[deviceID] = current
+
+	if previous.Healthy == current.Healthy {
+		return HealthEvent{}, false
+	}
+
+	return HealthEvent{
+		DeviceID: deviceID,
+		Previous: previous,
+		Current:  current,
+	}, true
+}
+
+// recordFlap counts the transition to unhealthy and quarantines the device if it flaps too often.
+func (h *healthTracker) recordFlap(history *healthHistory, current *HealthState, now time.Time) {
+	quarantine := h.hysteresis.Quarantine
+	if quarantine.FlapThreshold <= 0 {
+		return
+	}
+
+	flaps := history.flaps[:0]
+	for _, flap := range history.flaps {
+		if now.Sub(flap) < quarantine.Window.Duration {
+			flaps = append(flaps, flap)
+		}
+	}
+	history.flaps = append(flaps, now)
+
+	if len(history.flaps) >= quarantine.FlapThreshold {
+		current.QuarantinedUntil = now.Add(quarantine.Duration.Duration)
+	}
+}
+
+// retain forgets the devices which are not in the given devices, e.g. the devices of a removed card.
+func (h *healthTracker) retain(devices map[string]furiosa_device.FuriosaDevice) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for deviceID := range h.states {
+		if _, exist := devices[deviceID]; !exist {
+			delete(h.states, deviceID)
+			delete(h.histories, deviceID)
+		}
+	}
+}
+
+func (h *healthTracker) state(deviceID string) (HealthState, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	state, exist := h.states[deviceID]
+	return state, exist
+}
+
+func (h *healthTracker) snapshot() map[string]HealthState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ret := make(map[string]HealthState, len(h.states))
+	for deviceID, state := range h.states {
+		ret[deviceID] = state
+	}
+
+	return ret
+}
@@ -0,0 +1,268 @@
+package device_manager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/health_checker"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeHealthDevice overrides the health of FuriosaDevice.
+type fakeHealthDevice struct {
+	furiosa_device.FuriosaDevice
+	healthy bool
+	err     error
+}
+
+func (f *fakeHealthDevice) IsHealthy() (bool, error) {
+	return f.healthy, f.err
+}
+
+func TestHealthTrackerUpdate(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		description    string
+		checks         []bool
+		expectedEvents []bool
+		expectedState  HealthState
+	}{
+		{
+			description:    "first observation is not a transition",
+			checks:         []bool{true},
+			expectedEvents: []bool{false},
+			expectedState:  HealthState{Healthy: true, LastChecked: base, LastTransition: base},
+		},
+		{
+			description:    "same state keeps the transition time",
+			checks:         []bool{true, true, true},
+			expectedEvents: []bool{false, false, false},
+			expectedState:  HealthState{Healthy: true, LastChecked: base.Add(2 * time.Second), LastTransition: base},
+		},
+		{
+			description:    "each change is a transition",
+			checks:         []bool{true, false, false, true},
+			expectedEvents: []bool{false, true, false, true},
+			expectedState:  HealthState{Healthy: true, LastChecked: base.Add(3 * time.Second), LastTransition: base.Add(3 * time.Second)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			tick := 0
+			tracker := healthTracker{now: func() time.Time {
+				now := base.Add(time.Duration(tick) * time.Second)
+				tick++
+				return now
+			}}
+
+			for i, healthy := range tc.checks {
+				_, changed := tracker.update("npu0", healthy, "")
+				assert.Equal(t, tc.expectedEvents[i], changed, "check %d", i)
+			}
+
+			actual, exist := tracker.state("npu0")
+			assert.True(t, exist)
+			assert.Equal(t, tc.expectedState, actual)
+		})
+	}
+}
+
+func TestHealthTrackerHysteresis(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	quarantine := config.QuarantineConfig{
+		FlapThreshold: 2,
+		Window:        metav1.Duration{Duration: 10 * time.Second},
+		Duration:      metav1.Duration{Duration: 5 * time.Second},
+	}
+
+	tests := []struct {
+		description     string
+		hysteresis      config.HealthHysteresisConfig
+		checks          []bool
+		expectedHealthy []bool
+	}{
+		{
+			description:     "default hysteresis follows every change",
+			hysteresis:      config.HealthHysteresisConfig{FailureThreshold: 1, SuccessThreshold: 1},
+			checks:          []bool{true, false, true, false},
+			expectedHealthy: []bool{true, false, true, false},
+		},
+		{
+			description:     "transient failures are ignored",
+			hysteresis:      config.HealthHysteresisConfig{FailureThreshold: 3, SuccessThreshold: 1},
+			checks:          []bool{true, false, false, true, false, false, false},
+			expectedHealthy: []bool{true, true, true, true, true, true, false},
+		},
+		{
+			description:     "recovery requires consecutive successes",
+			hysteresis:      config.HealthHysteresisConfig{FailureThreshold: 1, SuccessThreshold: 2},
+			checks:          []bool{true, false, true, false, true, true},
+			expectedHealthy: []bool{true, false, false, false, false, true},
+		},
+		{
+			description:     "flapping device is quarantined",
+			hysteresis:      config.HealthHysteresisConfig{FailureThreshold: 1, SuccessThreshold: 1, Quarantine: quarantine},
+			checks:          []bool{true, false, true, false, true, true, true, true, true, true},
+			expectedHealthy: []bool{true, false, true, false, false, false, false, false, true, true},
+		},
+		{
+			description:     "flaps out of the window don't quarantine",
+			hysteresis:      config.HealthHysteresisConfig{FailureThreshold: 1, SuccessThreshold: 1, Quarantine: quarantine},
+			checks:          []bool{true, false, true, true, true, true, true, true, true, true, true, true, true, false, true},
+			expectedHealthy: []bool{true, false, true, true, true, true, true, true, true, true, true, true, true, false, true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			tick := 0
+			tracker := healthTracker{
+				hysteresis: tc.hysteresis,
+				now: func() time.Time {
+					now := base.Add(time.Duration(tick) * time.Second)
+					tick++
+					return now
+				},
+			}
+
+			for i, healthy := range tc.checks {
+				tracker.update("npu0", healthy, "liveness check failed")
+				actual, _ := tracker.state("npu0")
+				assert.Equal(t, tc.expectedHealthy[i], actual.Healthy, "check %d: %s", i, actual.Reason)
+			}
+		})
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	furiosaDevices := map[string]furiosa_device.FuriosaDevice{}
+	fakeDevices := map[string]*fakeHealthDevice{}
+	for id, furiosaDevice := range MockFuriosaDevices(mockDevices) {
+		fakeDevice := &fakeHealthDevice{FuriosaDevice: furiosaDevice, healthy: true}
+		furiosaDevices[id] = fakeDevice
+		fakeDevices[id] = fakeDevice
+	}
+
+	mockDeviceManager := &deviceManager{
+		deviceSet: deviceSet{
+			origin:         mockDevices,
+			furiosaDevices: furiosaDevices,
+		},
+		resourceName: "furiosa.ai/rngd",
+	}
+
+	// the first check records the initial states without events.
+	assert.Empty(t, mockDeviceManager.HealthCheck())
+	assert.Len(t, mockDeviceManager.HealthStates(), 8)
+
+	// nothing is changed.
+	assert.Empty(t, mockDeviceManager.HealthCheck())
+
+	fakeDevices["A76AAD68-6855-40B1-9E86-D080852D1C81"].healthy = false
+	fakeDevices["A76AAD68-6855-40B1-9E86-D080852D1C85"].err = fmt.Errorf("liveness error")
+
+	events := mockDeviceManager.HealthCheck()
+	assert.Len(t, events, 2)
+	assert.Equal(t, "A76AAD68-6855-40B1-9E86-D080852D1C81", events[0].DeviceID)
+	assert.False(t, events[0].Current.Healthy)
+	assert.Equal(t, "liveness check failed", events[0].Current.Reason)
+	assert.Equal(t, "A76AAD68-6855-40B1-9E86-D080852D1C85", events[1].DeviceID)
+	assert.Equal(t, "liveness error", events[1].Current.Reason)
+
+	// unhealthy devices are reported without another check.
+	for _, device := range mockDeviceManager.GetListAndWatchResponse().Devices {
+		switch device.ID {
+		case "A76AAD68-6855-40B1-9E86-D080852D1C81", "A76AAD68-6855-40B1-9E86-D080852D1C85":
+			assert.Equal(t, "Unhealthy", device.Health)
+		default:
+			assert.Equal(t, "Healthy", device.Health)
+		}
+	}
+
+	assert.Empty(t, mockDeviceManager.HealthCheck())
+
+	fakeDevices["A76AAD68-6855-40B1-9E86-D080852D1C81"].healthy = true
+	events = mockDeviceManager.HealthCheck()
+	assert.Len(t, events, 1)
+	assert.True(t, events[0].Current.Healthy)
+	assert.False(t, events[0].Previous.Healthy)
+}
+
+// fakeCoreChecker reports the given cores of the card as faulty.
+type fakeCoreChecker struct {
+	uuid  string
+	cores []uint32
+}
+
+func (f *fakeCoreChecker) Name() string {
+	return "fake"
+}
+
+func (f *fakeCoreChecker) Check(device smi.Device) health_checker.Result {
+	info, _ := device.DeviceInfo()
+	if info.UUID() != f.uuid {
+		return health_checker.Result{Healthy: true}
+	}
+
+	return health_checker.Result{Healthy: false, Reason: "faulty cores", Cores: f.cores}
+}
+
+func TestHealthCheckWithHealthCheckers(t *testing.T) {
+	tests := []struct {
+		description       string
+		policy            furiosa_device.PartitioningPolicy
+		cores             []uint32
+		expectedUnhealthy []string
+	}{
+		{
+			description:       "failure of a card affects the exclusive device",
+			policy:            furiosa_device.NonePolicy,
+			cores:             nil,
+			expectedUnhealthy: []string{"A76AAD68-6855-40B1-9E86-D080852D1C82"},
+		},
+		{
+			description: "failure of a card affects every partition",
+			policy:      furiosa_device.QuadCorePolicy,
+			cores:       nil,
+			expectedUnhealthy: []string{
+				"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_0-3",
+				"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_4-7",
+			},
+		},
+		{
+			description:       "faulty cores affect the partitions containing them",
+			policy:            furiosa_device.DualCorePolicy,
+			cores:             []uint32{3},
+			expectedUnhealthy: []string{"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_2-3"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := config.NewDefaultConfig()
+			cfg.PartitioningPolicy = tc.policy
+
+			manager, err := NewDeviceManager("furiosa.ai/rngd", tc.policy, smi.GetStaticMockDevices(smi.ArchRngd), nil, cfg)
+			assert.NoError(t, err)
+
+			mockDeviceManager := manager.(*deviceManager)
+			mockDeviceManager.healthCheckers = []health_checker.HealthChecker{
+				&fakeCoreChecker{uuid: "A76AAD68-6855-40B1-9E86-D080852D1C82", cores: tc.cores},
+			}
+
+			var actual []string
+			for _, event := range mockDeviceManager.HealthCheck() {
+				assert.Equal(t, "faulty cores", event.Current.Reason)
+				actual = append(actual, event.DeviceID)
+			}
+			assert.Equal(t, tc.expectedUnhealthy, actual)
+		})
+	}
+}
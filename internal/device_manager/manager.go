@@ -2,10 +2,15 @@ package device_manager
 
 import (
 	"fmt"
+	"maps"
+	"sort"
 	"strings"
+	"sync"
 
 	devicePluginAPIv1Beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/health_checker"
 	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
 	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
 	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/npu_allocator"
@@ -14,24 +19,116 @@ import (
 type DeviceManager interface {
 	ResourceName() string
 	Devices() []string
-	HealthCheck() error
+	FuriosaDevices() []furiosa_device.FuriosaDevice
+	BlockedDevices() map[string]string
+	Cards() []Card
+	HealthCheck() []HealthEvent
+	HealthStates() map[string]HealthState
 	Contains(deviceIDs []string) (bool, []string)
 	GetListAndWatchResponse() *devicePluginAPIv1Beta1.ListAndWatchResponse
 	GetContainerPreferredAllocationResponse(available []string, required []string, request int) (*devicePluginAPIv1Beta1.ContainerPreferredAllocationResponse, error)
 	GetContainerAllocateResponse(deviceIDs []string) (*devicePluginAPIv1Beta1.ContainerAllocateResponse, error)
+	Update(devices []smi.Device, blockedDeviceSelectors []BlockedDeviceSelector) (bool, error)
 }
 
 var _ DeviceManager = (*deviceManager)(nil)
 
-type deviceManager struct {
+// deviceSet is the state of DeviceManager derived from the cards, it is replaced as a whole when the cards are changed.
+type deviceSet struct {
 	origin         []smi.Device
 	furiosaDevices map[string]furiosa_device.FuriosaDevice
-	resourceName   string
-	debugMode      bool
+	blockedDevices map[string]string
 	allocator      npu_allocator.NpuAllocator
+	partitions     map[string]devicePartition
+	topologyGroups map[string]uint32
+}
+
+// newDeviceSet builds deviceSet of the cards partitioned with the policy.
+func newDeviceSet(devices []smi.Device, policy furiosa_device.PartitioningPolicy, blockedDeviceSelectors []BlockedDeviceSelector, allocatorCfg allocatorConfig) (deviceSet, error) {
+	blockedDevices, err := resolveBlockedDevices(devices, blockedDeviceSelectors)
+	if err != nil {
+		return deviceSet{}, err
+	}
+
+	var blockedList []string
+	for uuid := range blockedDevices {
+		blockedList = append(blockedList, uuid)
+	}
+
+	furiosaDevices, err := furiosa_device.NewFuriosaDevices(devices, blockedList, policy)
+	if err != nil {
+		return deviceSet{}, err
+	}
+
+	allocator, err := newNpuAllocator(allocatorCfg, devices, policy)
+	if err != nil {
+		return deviceSet{}, err
+	}
+
+	partitions, err := buildDevicePartitions(devices, policy)
+	if err != nil {
+		return deviceSet{}, err
+	}
+
+	topologyGroups, err := buildTopologyGroups(devices)
+	if err != nil {
+		return deviceSet{}, err
+	}
+
+	furiosaDevicesMap := map[string]furiosa_device.FuriosaDevice{}
+	for _, d := range furiosaDevices {
+		furiosaDevicesMap[d.DeviceID()] = d
+	}
+
+	return deviceSet{
+		origin:         devices,
+		furiosaDevices: furiosaDevicesMap,
+		blockedDevices: blockedDevices,
+		allocator:      allocator,
+		partitions:     partitions,
+		topologyGroups: topologyGroups,
+	}, nil
+}
+
+// sameDevices returns whether both sets advertise the same devices with the same blocked cards.
+func (s deviceSet) sameDevices(other deviceSet) bool {
+	if len(s.furiosaDevices) != len(other.furiosaDevices) || !maps.Equal(s.blockedDevices, other.blockedDevices) {
+		return false
+	}
+
+	for id := range s.furiosaDevices {
+		if _, exist := other.furiosaDevices[id]; !exist {
+			return false
+		}
+	}
+
+	return true
+}
+
+type deviceManager struct {
+	// mu guards deviceSet, which is replaced by Update while the plugin server is serving.
+	mu sync.RWMutex
+	deviceSet
+
+	policy                 furiosa_device.PartitioningPolicy
+	blockedDeviceSelectors []BlockedDeviceSelector
+	allocatorCfg           allocatorConfig
+	resourceName           string
+	debugMode              bool
+	healthCheckers         []health_checker.HealthChecker
+	health                 healthTracker
+	deviceInjection        config.DeviceInjectionMode
+	containerEnvs          []containerEnvTemplate
 }
 
-func (d *deviceManager) Devices() (ret []string) {
+func (d *deviceManager) Devices() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.deviceIDs()
+}
+
+func (d *deviceManager) deviceIDs() (ret []string) {
 	for id := range d.furiosaDevices {
 		ret = append(ret, id)
 	}
@@ -39,22 +136,163 @@ func (d *deviceManager) Devices() (ret []string) {
 	return ret
 }
 
-func (d *deviceManager) HealthCheck() error {
-	for _, dev := range d.furiosaDevices {
-		healthy, err := dev.IsHealthy()
+// FuriosaDevices returns the devices which can be allocated, the devices of the blocked cards are excluded.
+func (d *deviceManager) FuriosaDevices() (ret []furiosa_device.FuriosaDevice) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for id, device := range d.furiosaDevices {
+		if _, blocked := d.blockedDevices[d.partitions[id].uuid]; blocked {
+			continue
+		}
+		ret = append(ret, device)
+	}
+
+	return ret
+}
+
+// BlockedDevices returns the reason of the block keyed by UUID of the blocked cards.
+// Blocked cards and their partitions are always reported as unhealthy.
+func (d *deviceManager) BlockedDevices() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.blockedDevices
+}
+
+// Cards returns the cards managed by DeviceManager with the partitions ordered by PE cores.
+func (d *deviceManager) Cards() []Card {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var cards []Card
+
+	for _, origin := range d.origin {
+		card := Card{Device: origin, Policy: d.policy}
+		if info, err := origin.DeviceInfo(); err == nil {
+			card.Arch = info.Arch()
+		}
+
+		for deviceID, partition := range d.partitions {
+			if partition.card == origin {
+				card.Partitions = append(card.Partitions, Partition{ID: deviceID, Start: partition.start, End: partition.end})
+			}
+		}
+
+		sort.Slice(card.Partitions, func(i, j int) bool {
+			return card.Partitions[i].Start < card.Partitions[j].Start
+		})
+		cards = append(cards, card)
+	}
+
+	return cards
+}
+
+// HealthCheck checks the health of every device and returns the devices whose health is changed since the last check.
+func (d *deviceManager) HealthCheck() []HealthEvent {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var events []HealthEvent
+
+	cardFailures := d.checkCards()
+
+	deviceIDs := d.deviceIDs()
+	sort.Strings(deviceIDs)
+
+	for _, deviceID := range deviceIDs {
+		var failures []health_checker.Result
+		if partition, exist := d.partitions[deviceID]; exist {
+			for _, failure := range cardFailures[partition.uuid] {
+				if failure.Affects(partition.start, partition.end) {
+					failures = append(failures, failure)
+				}
+			}
+		}
+
+		if event, changed := d.checkHealth(d.furiosaDevices[deviceID], failures); changed {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// checkCards runs the health checkers once per card and returns the failures keyed by uuid of the card.
+func (d *deviceManager) checkCards() map[string][]health_checker.Result {
+	if len(d.healthCheckers) == 0 {
+		return nil
+	}
+
+	cardFailures := make(map[string][]health_checker.Result)
+	for _, card := range d.origin {
+		info, err := card.DeviceInfo()
 		if err != nil {
-			return err
+			// the liveness check of the devices on the card reports the failure.
+			continue
+		}
+
+		cardFailures[info.UUID()] = health_checker.CheckAll(d.healthCheckers, card)
+	}
+
+	return cardFailures
+}
+
+// HealthStates returns the last known health of devices keyed by device id.
+func (d *deviceManager) HealthStates() map[string]HealthState {
+	return d.health.snapshot()
+}
+
+// checkHealth combines the liveness of the device and the failures of the health checkers affecting the device.
+func (d *deviceManager) checkHealth(dev furiosa_device.FuriosaDevice, failures []health_checker.Result) (HealthEvent, bool) {
+	healthy, err := dev.IsHealthy()
+	reason := ""
+
+	switch {
+	case err != nil:
+		healthy = false
+		reason = err.Error()
+	case !healthy:
+		reason = d.unhealthyReason(dev.DeviceID())
+	case len(failures) > 0:
+		var reasons []string
+		for _, failure := range failures {
+			reasons = append(reasons, failure.Reason)
 		}
 
-		if !healthy {
-			return fmt.Errorf("device %s is not healthy", dev.DeviceID())
+		healthy = false
+		reason = strings.Join(reasons, "; ")
+	}
+
+	return d.health.update(dev.DeviceID(), healthy, reason)
+}
+
+func (d *deviceManager) unhealthyReason(deviceID string) string {
+	// partitions of a blocked card have the uuid of the card as prefix of the device id.
+	for uuid, reason := range d.blockedDevices {
+		if strings.HasPrefix(deviceID, uuid) {
+			return reason
 		}
 	}
 
-	return nil
+	return "liveness check failed"
+}
+
+// healthStateOf returns the last known health of the device, the device is checked if it has never been checked.
+func (d *deviceManager) healthStateOf(dev furiosa_device.FuriosaDevice) HealthState {
+	if state, exist := d.health.state(dev.DeviceID()); exist {
+		return state
+	}
+
+	d.checkHealth(dev, nil)
+	state, _ := d.health.state(dev.DeviceID())
+	return state
 }
 
 func (d *deviceManager) Contains(deviceIDs []string) (bool, []string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	var missing []string
 
 	if len(deviceIDs) == 0 {
@@ -107,6 +345,9 @@ func fetchDevicesByID(furiosaDevices map[string]furiosa_device.FuriosaDevice, ID
 }
 
 func (d *deviceManager) GetContainerPreferredAllocationResponse(available []string, required []string, request int) (*devicePluginAPIv1Beta1.ContainerPreferredAllocationResponse, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	availableDevices, err := fetchDevicesByID(d.furiosaDevices, available)
 	if err != nil {
 		return nil, err
@@ -129,13 +370,38 @@ func (d *deviceManager) GetContainerPreferredAllocationResponse(available []stri
 }
 
 func (d *deviceManager) GetContainerAllocateResponse(deviceIDs []string) (*devicePluginAPIv1Beta1.ContainerAllocateResponse, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	deviceRequests, err := fetchByID(d.furiosaDevices, deviceIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	//TODO(@bg): support CDI
-	resp, err := buildDeviceSpecToContainerAllocateResponse(deviceRequests...)
+	resp := &devicePluginAPIv1Beta1.ContainerAllocateResponse{}
+	if d.deviceInjection.UsesLegacy() {
+		resp, err = buildDeviceSpecToContainerAllocateResponse(deviceRequests...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the CDI devices are resolved by the container runtime with the spec written at startup.
+	if d.deviceInjection.UsesCDI() {
+		buildCDIDevicesToContainerAllocateResponse(resp, deviceRequests...)
+	}
+
+	allocated, err := d.allocatedDevices(deviceRequests...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Envs, err = d.buildContainerEnvs(allocated)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Annotations, err = buildAnnotations(allocated)
 	if err != nil {
 		return nil, err
 	}
@@ -144,25 +410,33 @@ func (d *deviceManager) GetContainerAllocateResponse(deviceIDs []string) (*devic
 }
 
 func (d *deviceManager) GetListAndWatchResponse() *devicePluginAPIv1Beta1.ListAndWatchResponse {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	var resp []*devicePluginAPIv1Beta1.Device
 
 	for _, dev := range d.furiosaDevices {
 		var health = devicePluginAPIv1Beta1.Healthy
-		isHealthy, err := dev.IsHealthy()
-		if err != nil || !isHealthy {
+		if !d.healthStateOf(dev).Healthy {
 			health = devicePluginAPIv1Beta1.Unhealthy
 		}
 
-		resp = append(resp, &devicePluginAPIv1Beta1.Device{
-			ID:     dev.DeviceID(),
-			Health: health,
-			Topology: &devicePluginAPIv1Beta1.TopologyInfo{
+		// smi reports -1 if the NUMA node of the device is unknown, the device has no NUMA affinity then.
+		var topology *devicePluginAPIv1Beta1.TopologyInfo
+		if dev.NUMANode() >= 0 {
+			topology = &devicePluginAPIv1Beta1.TopologyInfo{
 				Nodes: []*devicePluginAPIv1Beta1.NUMANode{
 					{
 						ID: int64(dev.NUMANode()),
 					},
 				},
-			},
+			}
+		}
+
+		resp = append(resp, &devicePluginAPIv1Beta1.Device{
+			ID:       dev.DeviceID(),
+			Health:   health,
+			Topology: topology,
 		})
 	}
 
@@ -175,32 +449,71 @@ func (d *deviceManager) ResourceName() string {
 	return d.resourceName
 }
 
-func NewDeviceManager(arch smi.Arch, devices []smi.Device, debugMode bool) (DeviceManager, error) {
-	resName, err := buildAndValidateFullResourceEndpointName(arch)
+// Update replaces the cards and the selectors of the blocked cards in place, e.g. when a card is hot-plugged or removed or
+// the node annotation is changed, and returns whether the devices are changed.
+// The health of the remaining devices is kept, and the added devices are checked when they are listed.
+func (d *deviceManager) Update(devices []smi.Device, blockedDeviceSelectors []BlockedDeviceSelector) (bool, error) {
+	set, err := newDeviceSet(devices, d.policy, blockedDeviceSelectors, d.allocatorCfg)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	furiosaDevices, err := furiosa_device.NewFuriosaDevices(devices, nil, furiosa_device.NonePolicy)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.blockedDeviceSelectors = blockedDeviceSelectors
+	if d.deviceSet.sameDevices(set) {
+		return false, nil
+	}
+
+	// the devices of the cards blocked or unblocked are checked again when they are listed, same as the added devices.
+	retained := make(map[string]furiosa_device.FuriosaDevice, len(set.furiosaDevices))
+	for deviceID, device := range set.furiosaDevices {
+		uuid := set.partitions[deviceID].uuid
+		_, blocked := set.blockedDevices[uuid]
+		_, wasBlocked := d.blockedDevices[uuid]
+		if blocked == wasBlocked {
+			retained[deviceID] = device
+		}
+	}
+
+	d.deviceSet = set
+	d.health.retain(retained)
+	return true, nil
+}
+
+// NewDeviceManager returns DeviceManager of the devices exposed under the resource name, see BuildDeviceMap.
+func NewDeviceManager(resourceName string, policy furiosa_device.PartitioningPolicy, devices []smi.Device, blockedDeviceSelectors []BlockedDeviceSelector, cfg *config.Config) (DeviceManager, error) {
+	allocatorCfg := allocatorConfig{
+		allocatorType: cfg.AllocatorFor(resourceName),
+		numaAffinity:  cfg.NUMAAffinity,
+		searchBudget:  cfg.AllocationSearchBudget.Duration,
+	}
+	set, err := newDeviceSet(devices, policy, blockedDeviceSelectors, allocatorCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	allocator, err := npu_allocator.NewScoreBasedOptimalNpuAllocator(devices)
+	containerEnvs, err := newContainerEnvTemplates(resourceName, cfg.ContainerEnvs)
 	if err != nil {
 		return nil, err
 	}
 
-	furiosaDevicesMap := map[string]furiosa_device.FuriosaDevice{}
-	for _, d := range furiosaDevices {
-		furiosaDevicesMap[d.DeviceID()] = d
+	manager := &deviceManager{
+		deviceSet:              set,
+		policy:                 policy,
+		blockedDeviceSelectors: blockedDeviceSelectors,
+		allocatorCfg:           allocatorCfg,
+		resourceName:           resourceName,
+		debugMode:              cfg.DebugMode,
+		healthCheckers:         health_checker.NewHealthCheckers(cfg.HealthChecks),
+		health:                 healthTracker{hysteresis: cfg.HealthHysteresis},
+		deviceInjection:        cfg.DeviceInjection,
+		containerEnvs:          containerEnvs,
 	}
 
-	return &deviceManager{
-		origin:         devices,
-		furiosaDevices: furiosaDevicesMap,
-		resourceName:   resName,
-		debugMode:      debugMode,
-		allocator:      allocator,
-	}, nil
+	// record the initial health so that the first ListAndWatch response and later transitions are based on it.
+	manager.HealthCheck()
+
+	return manager, nil
 }
@@ -1,8 +1,11 @@
 package device_manager
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
 	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
 	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
 	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/npu_allocator"
@@ -101,8 +104,6 @@ func staticMockTopologyHintProvider() npu_allocator.TopologyHintProvider {
 	}
 }
 
-// TODO(@bg): Add test for bin packing allocator once it is ready.
-
 func prefix(prefix string, origin []string) []string {
 	var ret []string
 
@@ -303,11 +304,13 @@ func TestGetContainerPreferredAllocationResponseWithScoreBasedOptimalNpuAllocato
 			mockFuriosaDevices := MockFuriosaDevices(mockDevices)
 			allocator, _ := npu_allocator.NewMockScoreBasedOptimalNpuAllocator(staticMockTopologyHintProvider())
 			mockDeviceManager := &deviceManager{
-				origin:         mockDevices,
-				furiosaDevices: mockFuriosaDevices,
-				resourceName:   "furiosa.ai/npu",
-				debugMode:      false,
-				allocator:      allocator,
+				deviceSet: deviceSet{
+					origin:         mockDevices,
+					furiosaDevices: mockFuriosaDevices,
+					allocator:      allocator,
+				},
+				resourceName: "furiosa.ai/npu",
+				debugMode:    false,
 			}
 
 			completeAvailable := prefix("A76AAD68-6855-40B1-9E86-D080852D1C8", tc.available)
@@ -320,6 +323,15 @@ func TestGetContainerPreferredAllocationResponseWithScoreBasedOptimalNpuAllocato
 			completeExpectedResult := prefix("A76AAD68-6855-40B1-9E86-D080852D1C8", tc.expectedResult.DeviceIDs)
 
 			assert.Equal(t, completeExpectedResult, actualResult.DeviceIDs)
+
+			// the score-based allocator of the configuration allocates the same devices.
+			cfg := config.NewDefaultConfig()
+			cfg.Allocator = config.ScoreBasedAllocator
+			manager, err := NewDeviceManager("furiosa.ai/npu", furiosa_device.NonePolicy, mockDevices, nil, cfg)
+			assert.NoError(t, err)
+			actualResult, actualError = manager.GetContainerPreferredAllocationResponse(completeAvailable, completeRequired, tc.request)
+			assert.NoError(t, actualError)
+			assert.ElementsMatch(t, completeExpectedResult, actualResult.DeviceIDs)
 		})
 	}
 }
@@ -336,7 +348,14 @@ func TestGetContainerAllocateResponseForRNGD(t *testing.T) {
 			description: "allocate one device",
 			deviceIDs:   []string{"0"},
 			expectedResult: &devicePluginAPIv1Beta1.ContainerAllocateResponse{
-				Envs:   nil,
+				Envs: map[string]string{
+					"FURIOSA_DEVICE_IDS":        "A76AAD68-6855-40B1-9E86-D080852D1C80",
+					"FURIOSA_DEVICE_UUIDS":      "A76AAD68-6855-40B1-9E86-D080852D1C80",
+					"FURIOSA_DEVICE_INDICES":    "0",
+					"FURIOSA_DEVICE_PE_CORES":   "0-7",
+					"FURIOSA_DEVICE_NUMA_NODES": "0",
+					"FURIOSA_DEVICE_ARCH":       "rngd",
+				},
 				Mounts: nil,
 				Devices: []*devicePluginAPIv1Beta1.DeviceSpec{
 					{
@@ -515,8 +534,10 @@ func TestGetContainerAllocateResponseForRNGD(t *testing.T) {
 						Permissions:   "rw",
 					},
 				},
-				Annotations: nil,
-				CdiDevices:  nil,
+				Annotations: map[string]string{
+					"furiosa.ai/allocated-devices": `[{"id":"A76AAD68-6855-40B1-9E86-D080852D1C80","arch":"rngd","uuid":"A76AAD68-6855-40B1-9E86-D080852D1C80","index":0,"bdf":"0000:27:00.0","serial":"TEST0236FH505KRE0","firmwareVersion":"1.6.0(dev0), c1bebfd","numaNode":0,"startCore":0,"endCore":7,"topologyGroup":0}]`,
+				},
+				CdiDevices: nil,
 			},
 			expectError: false,
 		},
@@ -527,12 +548,22 @@ func TestGetContainerAllocateResponseForRNGD(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
 			mockFuriosaDevices := MockFuriosaDevices(mockDevices)
+			partitions, err := buildDevicePartitions(mockDevices, furiosa_device.NonePolicy)
+			assert.NoError(t, err)
+
+			topologyGroups, err := buildTopologyGroups(mockDevices)
+			assert.NoError(t, err)
+
 			mockDeviceManager := &deviceManager{
-				origin:         mockDevices,
-				furiosaDevices: mockFuriosaDevices,
-				resourceName:   "furiosa.ai/npu",
-				debugMode:      false,
-				allocator:      nil,
+				deviceSet: deviceSet{
+					origin:         mockDevices,
+					furiosaDevices: mockFuriosaDevices,
+					allocator:      nil,
+					partitions:     partitions,
+					topologyGroups: topologyGroups,
+				},
+				resourceName: "furiosa.ai/npu",
+				debugMode:    false,
 			}
 
 			actualResult, actualError := mockDeviceManager.GetContainerAllocateResponse(prefix("A76AAD68-6855-40B1-9E86-D080852D1C8", tc.deviceIDs))
@@ -546,3 +577,253 @@ func TestGetContainerAllocateResponseForRNGD(t *testing.T) {
 		})
 	}
 }
+
+func deviceSpecs(paths ...string) []*devicePluginAPIv1Beta1.DeviceSpec {
+	var ret []*devicePluginAPIv1Beta1.DeviceSpec
+	for _, path := range paths {
+		ret = append(ret, &devicePluginAPIv1Beta1.DeviceSpec{
+			ContainerPath: path,
+			HostPath:      path,
+			Permissions:   "rw",
+		})
+	}
+
+	return ret
+}
+
+func rngdSharedDevicePaths(npu int) []string {
+	var ret []string
+	for i := 0; i < 8; i++ {
+		ret = append(ret, fmt.Sprintf("/dev/rngd/npu%dch%d", npu, i))
+	}
+	for i := 0; i < 8; i++ {
+		ret = append(ret, fmt.Sprintf("/dev/rngd/npu%dch%dr", npu, i))
+	}
+
+	return append(ret,
+		fmt.Sprintf("/dev/rngd/npu%ddmar", npu),
+		fmt.Sprintf("/dev/rngd/npu%dbar0", npu),
+		fmt.Sprintf("/dev/rngd/npu%dbar2", npu),
+		fmt.Sprintf("/dev/rngd/npu%dbar4", npu),
+	)
+}
+
+func TestGetContainerAllocateResponseForPartitionedRNGD(t *testing.T) {
+	tests := []struct {
+		description   string
+		policy        furiosa_device.PartitioningPolicy
+		deviceIDs     []string
+		expectedPaths []string
+	}{
+		{
+			description: "allocate one dual-core partition",
+			policy:      furiosa_device.DualCorePolicy,
+			deviceIDs:   []string{"0_cores_2-3"},
+			expectedPaths: append([]string{
+				"/dev/rngd/npu0mgmt",
+				"/dev/rngd/npu0pe2",
+				"/dev/rngd/npu0pe3",
+				"/dev/rngd/npu0pe2-3",
+			}, rngdSharedDevicePaths(0)...),
+		},
+		{
+			description: "allocate two single-core partitions of the same card without duplicated device nodes",
+			policy:      furiosa_device.SingleCorePolicy,
+			deviceIDs:   []string{"1_cores_4", "1_cores_5"},
+			expectedPaths: append(append([]string{
+				"/dev/rngd/npu1mgmt",
+				"/dev/rngd/npu1pe4",
+			}, rngdSharedDevicePaths(1)...),
+				"/dev/rngd/npu1pe5",
+			),
+		},
+		{
+			description: "allocate one quad-core partition",
+			policy:      furiosa_device.QuadCorePolicy,
+			deviceIDs:   []string{"7_cores_4-7"},
+			expectedPaths: append([]string{
+				"/dev/rngd/npu7mgmt",
+				"/dev/rngd/npu7pe4",
+				"/dev/rngd/npu7pe5",
+				"/dev/rngd/npu7pe4-5",
+				"/dev/rngd/npu7pe6",
+				"/dev/rngd/npu7pe7",
+				"/dev/rngd/npu7pe6-7",
+				"/dev/rngd/npu7pe4-7",
+			}, rngdSharedDevicePaths(7)...),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+			mockFuriosaDevices, err := furiosa_device.NewFuriosaDevices(mockDevices, nil, tc.policy)
+			assert.NoError(t, err)
+
+			furiosaDevicesMap := make(map[string]furiosa_device.FuriosaDevice, len(mockFuriosaDevices))
+			for _, furiosaDevice := range mockFuriosaDevices {
+				furiosaDevicesMap[furiosaDevice.DeviceID()] = furiosaDevice
+			}
+
+			partitions, err := buildDevicePartitions(mockDevices, tc.policy)
+			assert.NoError(t, err)
+
+			mockDeviceManager := &deviceManager{
+				deviceSet: deviceSet{
+					origin:         mockDevices,
+					furiosaDevices: furiosaDevicesMap,
+					allocator:      nil,
+					partitions:     partitions,
+				},
+				resourceName: "furiosa.ai/rngd",
+				debugMode:    false,
+			}
+
+			actualResult, actualError := mockDeviceManager.GetContainerAllocateResponse(prefix("A76AAD68-6855-40B1-9E86-D080852D1C8", tc.deviceIDs))
+			assert.NoError(t, actualError)
+			assert.Equal(t, deviceSpecs(tc.expectedPaths...), actualResult.Devices)
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	blocked := NewBlockedDeviceSelectors(BlockSourceConfig, "A76AAD68-6855-40B1-9E86-D080852D1C81")
+	manager, err := NewDeviceManager("furiosa.ai/rngd-2core", furiosa_device.DualCorePolicy, mockDevices[:6], blocked, config.NewDefaultConfig())
+	assert.NoError(t, err)
+	assert.Len(t, manager.Devices(), 24)
+	assert.Len(t, manager.HealthStates(), 24)
+
+	tests := []struct {
+		description     string
+		devices         []smi.Device
+		expectedChanged bool
+		expectedCards   []uint32
+	}{
+		{
+			description:     "the same cards",
+			devices:         mockDevices[:6],
+			expectedChanged: false,
+			expectedCards:   []uint32{0, 1, 2, 3, 4, 5},
+		},
+		{
+			description:     "cards are added",
+			devices:         mockDevices,
+			expectedChanged: true,
+			expectedCards:   []uint32{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			description:     "cards are removed",
+			devices:         []smi.Device{mockDevices[0], mockDevices[1], mockDevices[7]},
+			expectedChanged: true,
+			expectedCards:   []uint32{0, 1, 7},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			changed, err := manager.Update(tc.devices, blocked)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedChanged, changed)
+
+			var cards []uint32
+			for _, card := range manager.Cards() {
+				info, _ := card.Device.DeviceInfo()
+				cards = append(cards, info.Index())
+				assert.Len(t, card.Partitions, 4)
+			}
+			assert.Equal(t, tc.expectedCards, cards)
+			assert.Len(t, manager.Devices(), 4*len(tc.expectedCards))
+
+			// the health of the removed devices is forgotten, and the blocked card is still blocked.
+			response := manager.GetListAndWatchResponse()
+			assert.Len(t, response.Devices, 4*len(tc.expectedCards))
+			assert.Len(t, manager.HealthStates(), 4*len(tc.expectedCards))
+			for _, device := range response.Devices {
+				expectedHealth := devicePluginAPIv1Beta1.Healthy
+				if strings.HasPrefix(device.ID, "A76AAD68-6855-40B1-9E86-D080852D1C81") {
+					expectedHealth = devicePluginAPIv1Beta1.Unhealthy
+				}
+				assert.Equal(t, expectedHealth, device.Health, device.ID)
+			}
+		})
+	}
+}
+
+func TestGetListAndWatchResponseTopology(t *testing.T) {
+	manager, err := NewDeviceManager("furiosa.ai/rngd-2core", furiosa_device.DualCorePolicy, mixedNUMADevices(), nil, config.NewDefaultConfig())
+	assert.NoError(t, err)
+
+	expectedNUMANodes := map[string]int64{
+		"A76AAD68-6855-40B1-9E86-D080852D1C80": 0,
+		"A76AAD68-6855-40B1-9E86-D080852D1C81": 0,
+		"A76AAD68-6855-40B1-9E86-D080852D1C82": 1,
+		"A76AAD68-6855-40B1-9E86-D080852D1C83": 1,
+		"A76AAD68-6855-40B1-9E86-D080852D1C84": 2,
+		"A76AAD68-6855-40B1-9E86-D080852D1C85": 2,
+	}
+
+	response := manager.GetListAndWatchResponse()
+	assert.Len(t, response.Devices, 32)
+	for _, device := range response.Devices {
+		uuid, _, _ := strings.Cut(device.ID, partitionDelimiter)
+		expected, known := expectedNUMANodes[uuid]
+		if !known {
+			// the devices of the unknown NUMA node have no topology rather than the node -1.
+			assert.Nil(t, device.Topology, device.ID)
+			continue
+		}
+
+		assert.Len(t, device.Topology.Nodes, 1, device.ID)
+		assert.Equal(t, expected, device.Topology.Nodes[0].ID, device.ID)
+	}
+}
+
+func TestUpdateBlockedDevices(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	manager, err := NewDeviceManager("furiosa.ai/rngd", furiosa_device.NonePolicy, mockDevices, nil, config.NewDefaultConfig())
+	assert.NoError(t, err)
+
+	tests := []struct {
+		description       string
+		blocked           []BlockedDeviceSelector
+		expectedChanged   bool
+		expectedUnhealthy []string
+	}{
+		{
+			description:       "block a card by the node annotation",
+			blocked:           ParseBlockedDevicesAnnotation("furiosa.ai/blocked-devices", "A76AAD68-6855-40B1-9E86-D080852D1C83"),
+			expectedChanged:   true,
+			expectedUnhealthy: []string{"A76AAD68-6855-40B1-9E86-D080852D1C83"},
+		},
+		{
+			description:       "the same blocked card",
+			blocked:           ParseBlockedDevicesAnnotation("furiosa.ai/blocked-devices", "A76AAD68-6855-40B1-9E86-D080852D1C83"),
+			expectedChanged:   false,
+			expectedUnhealthy: []string{"A76AAD68-6855-40B1-9E86-D080852D1C83"},
+		},
+		{
+			description:       "unblock the card",
+			blocked:           nil,
+			expectedChanged:   true,
+			expectedUnhealthy: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			changed, err := manager.Update(mockDevices, tc.blocked)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedChanged, changed)
+
+			// the health of the blocked or unblocked card is reported without waiting for the next health check.
+			var unhealthy []string
+			for _, device := range manager.GetListAndWatchResponse().Devices {
+				if device.Health == devicePluginAPIv1Beta1.Unhealthy {
+					unhealthy = append(unhealthy, device.ID)
+				}
+			}
+			assert.Equal(t, tc.expectedUnhealthy, unhealthy)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package device_manager
+
+import (
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+)
+
+// partitionDelimiter separates the card uuid and the PE core range in the device id of a partitioned device, the one of
+// furiosa_device is unexported.
+const partitionDelimiter = "_cores_"
+
+// devicePartition locates a FuriosaDevice on its card.
+type devicePartition struct {
+	uuid string
+	card smi.Device
+	// start and end are the first and the last PE cores of the device.
+	start uint32
+	end   uint32
+}
+
+// buildDevicePartitions maps the device id of every FuriosaDevice built from the cards with the policy to its location.
+func buildDevicePartitions(cards []smi.Device, policy furiosa_device.PartitioningPolicy) (map[string]devicePartition, error) {
+	partitions := make(map[string]devicePartition)
+
+	for _, card := range cards {
+		info, err := card.DeviceInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		if policy == furiosa_device.NonePolicy {
+			partitions[info.UUID()] = devicePartition{uuid: info.UUID(), card: card, start: 0, end: info.CoreNum() - 1}
+			continue
+		}
+
+		// the remaining cores are not used if the cores can't be split evenly, same as furiosa_device.
+		coreSize := uint32(policy.CoreSize())
+		for start := uint32(0); start+coreSize <= info.CoreNum(); start += coreSize {
+			partition := furiosa_device.Partition{Start: int(start), End: int(start + coreSize - 1)}
+			partitions[info.UUID()+partitionDelimiter+partition.String()] = devicePartition{
+				uuid:  info.UUID(),
+				card:  card,
+				start: start,
+				end:   start + coreSize - 1,
+			}
+		}
+	}
+
+	return partitions, nil
+}
+
+// Partition is a device advertised on a card, it occupies the PE cores from Start to End.
+type Partition struct {
+	ID    string
+	Start uint32
+	End   uint32
+}
+
+// Card is a physical card managed by DeviceManager and the devices advertised on it.
+type Card struct {
+	Device     smi.Device
+	Arch       smi.Arch
+	Policy     furiosa_device.PartitioningPolicy
+	Partitions []Partition
+}
+
+// PartitionOf returns the partition containing the PE core.
+func (c Card) PartitionOf(core uint32) (Partition, bool) {
+	for _, partition := range c.Partitions {
+		if partition.Start <= core && core <= partition.End {
+			return partition, true
+		}
+	}
+
+	return Partition{}, false
+}
@@ -0,0 +1,109 @@
+package device_manager
+
+import (
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDevicePartitions(t *testing.T) {
+	tests := []struct {
+		description    string
+		policy         furiosa_device.PartitioningPolicy
+		expectedCount  int
+		expectedID     string
+		expectedResult devicePartition
+	}{
+		{
+			description:   "exclusive devices occupy every core",
+			policy:        furiosa_device.NonePolicy,
+			expectedCount: 8,
+			expectedID:    "A76AAD68-6855-40B1-9E86-D080852D1C81",
+			expectedResult: devicePartition{
+				uuid:  "A76AAD68-6855-40B1-9E86-D080852D1C81",
+				start: 0,
+				end:   7,
+			},
+		},
+		{
+			description:   "quad-core partitions",
+			policy:        furiosa_device.QuadCorePolicy,
+			expectedCount: 16,
+			expectedID:    "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-7",
+			expectedResult: devicePartition{
+				uuid:  "A76AAD68-6855-40B1-9E86-D080852D1C81",
+				start: 4,
+				end:   7,
+			},
+		},
+		{
+			description:   "single-core partitions",
+			policy:        furiosa_device.SingleCorePolicy,
+			expectedCount: 64,
+			expectedID:    "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_5",
+			expectedResult: devicePartition{
+				uuid:  "A76AAD68-6855-40B1-9E86-D080852D1C81",
+				start: 5,
+				end:   5,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+			actual, err := buildDevicePartitions(mockDevices, tc.policy)
+			assert.NoError(t, err)
+			assert.Len(t, actual, tc.expectedCount)
+
+			// every FuriosaDevice must be located.
+			furiosaDevices, err := furiosa_device.NewFuriosaDevices(mockDevices, nil, tc.policy)
+			assert.NoError(t, err)
+			for _, furiosaDevice := range furiosaDevices {
+				assert.Contains(t, actual, furiosaDevice.DeviceID())
+			}
+
+			partition := actual[tc.expectedID]
+			assert.Equal(t, mockDevices[1], partition.card)
+			partition.card = nil
+			assert.Equal(t, tc.expectedResult, partition)
+		})
+	}
+}
+
+func TestPartitionDelimiter(t *testing.T) {
+	mockDevice := smi.GetStaticMockDevice(smi.ArchRngd, 0)
+	furiosaDevices, err := furiosa_device.NewFuriosaDevices([]smi.Device{mockDevice}, nil, furiosa_device.DualCorePolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, "A76AAD68-6855-40B1-9E86-D080852D1C80"+partitionDelimiter+"0-1", furiosaDevices[0].DeviceID())
+}
+
+func TestCards(t *testing.T) {
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	manager, err := NewDeviceManager("furiosa.ai/rngd-2core", furiosa_device.DualCorePolicy, mockDevices, nil, config.NewDefaultConfig())
+	assert.NoError(t, err)
+
+	cards := manager.Cards()
+	assert.Len(t, cards, len(mockDevices))
+
+	card := cards[1]
+	assert.Equal(t, mockDevices[1], card.Device)
+	assert.Equal(t, smi.ArchRngd, card.Arch)
+	assert.Equal(t, furiosa_device.DualCorePolicy, card.Policy)
+	assert.Equal(t, []Partition{
+		{ID: "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_0-1", Start: 0, End: 1},
+		{ID: "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_2-3", Start: 2, End: 3},
+		{ID: "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-5", Start: 4, End: 5},
+		{ID: "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_6-7", Start: 6, End: 7},
+	}, card.Partitions)
+
+	partition, exist := card.PartitionOf(5)
+	assert.True(t, exist)
+	assert.Equal(t, "A76AAD68-6855-40B1-9E86-D080852D1C81_cores_4-5", partition.ID)
+
+	_, exist = card.PartitionOf(8)
+	assert.False(t, exist)
+}
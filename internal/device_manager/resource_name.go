@@ -2,27 +2,51 @@ package device_manager
 
 import (
 	"fmt"
-	"strings"
 
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
 	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
 	"k8s.io/apimachinery/pkg/api/validation"
 )
 
-const (
-	defaultDomain   = "furiosa.ai"
-	fullResourceExp = "%s/%s"
-)
-
-func buildResourceEndpointName(arch smi.Arch) string {
-	return strings.ToLower(arch.ToString())
-}
+const fullResourceExp = "%s/%s"
 
-func buildAndValidateFullResourceEndpointName(arch smi.Arch) (string, error) {
-	endpointName := buildResourceEndpointName(arch)
+func buildAndValidateFullResourceEndpointName(domain string, endpointName string) (string, error) {
 	errs := validation.NameIsDNSSubdomain(endpointName, false)
 	if len(errs) != 0 {
 		return "", fmt.Errorf("resource name %s is not valid %v", endpointName, errs)
 	}
 
-	return fmt.Sprintf(fullResourceExp, defaultDomain, endpointName), nil
+	errs = validation.NameIsDNSSubdomain(domain, false)
+	if len(errs) != 0 {
+		return "", fmt.Errorf("resource domain %s is not valid %v", domain, errs)
+	}
+
+	return fmt.Sprintf(fullResourceExp, domain, endpointName), nil
+}
+
+// isKnownArch returns whether the device plugin knows the partitions and the device files of the arch.
+func isKnownArch(arch smi.Arch) bool {
+	switch arch {
+	case smi.ArchRngd, smi.ArchRngdMax, smi.ArchRngdS:
+		return true
+	default:
+		return false
+	}
+}
+
+// resolveUnknownArchResourceName returns the full fallback resource name of the cards of unknown architectures,
+// it returns the empty name if the cards are skipped.
+func resolveUnknownArchResourceName(policy furiosa_device.PartitioningPolicy, cfg *config.Config) (string, error) {
+	if cfg.UnknownArch.ResourceName == "" {
+		return "", nil
+	}
+
+	return buildAndValidateFullResourceEndpointName(cfg.ResourceDomain, config.PartitionedResourceName(cfg.UnknownArch.ResourceName, policy))
+}
+
+// resolveResourceName returns the full resource name of the devices of the arch partitioned with the policy.
+// The resource is named after the arch unless config.ResourceNameConfig selects the arch and the policy.
+func resolveResourceName(arch smi.Arch, policy furiosa_device.PartitioningPolicy, cfg *config.Config) (string, error) {
+	return buildAndValidateFullResourceEndpointName(cfg.ResolveResourceName(arch.ToString(), policy))
 }
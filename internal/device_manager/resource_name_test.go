@@ -0,0 +1,117 @@
+package device_manager
+
+import (
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveResourceName(t *testing.T) {
+	tests := []struct {
+		description    string
+		domain         string
+		resourceNames  []config.ResourceNameConfig
+		arch           smi.Arch
+		policy         furiosa_device.PartitioningPolicy
+		expectedResult string
+		expectedError  bool
+	}{
+		{
+			description:    "whole rngd device",
+			domain:         "furiosa.ai",
+			arch:           smi.ArchRngd,
+			policy:         furiosa_device.NonePolicy,
+			expectedResult: "furiosa.ai/rngd",
+			expectedError:  false,
+		},
+		{
+			description:    "single-core partition of rngd-s",
+			domain:         "furiosa.ai",
+			arch:           smi.ArchRngdS,
+			policy:         furiosa_device.SingleCorePolicy,
+			expectedResult: "furiosa.ai/rngd-s-1core",
+			expectedError:  false,
+		},
+		{
+			description:    "dual-core partition of rngd with custom domain",
+			domain:         "acme.com",
+			arch:           smi.ArchRngd,
+			policy:         furiosa_device.DualCorePolicy,
+			expectedResult: "acme.com/rngd-2core",
+			expectedError:  false,
+		},
+		{
+			description:    "quad-core partition of rngd-max",
+			domain:         "furiosa.ai",
+			arch:           smi.ArchRngdMax,
+			policy:         furiosa_device.QuadCorePolicy,
+			expectedResult: "furiosa.ai/rngd-max-4core",
+			expectedError:  false,
+		},
+		{
+			description:    "custom name with custom domain",
+			domain:         "furiosa.ai",
+			resourceNames:  []config.ResourceNameConfig{{Archs: []string{"rngd"}, Policy: furiosa_device.QuadCorePolicy, Domain: "acme.com", Name: "npu-large"}},
+			arch:           smi.ArchRngd,
+			policy:         furiosa_device.QuadCorePolicy,
+			expectedResult: "acme.com/npu-large",
+			expectedError:  false,
+		},
+		{
+			description:    "custom name for every policy",
+			domain:         "furiosa.ai",
+			resourceNames:  []config.ResourceNameConfig{{Archs: []string{"rngd", "rngd-max"}, Name: "npu"}},
+			arch:           smi.ArchRngdMax,
+			policy:         furiosa_device.DualCorePolicy,
+			expectedResult: "furiosa.ai/npu-2core",
+			expectedError:  false,
+		},
+		{
+			description:    "custom name for another policy",
+			domain:         "furiosa.ai",
+			resourceNames:  []config.ResourceNameConfig{{Archs: []string{"rngd"}, Policy: furiosa_device.QuadCorePolicy, Name: "npu-large"}},
+			arch:           smi.ArchRngd,
+			policy:         furiosa_device.NonePolicy,
+			expectedResult: "furiosa.ai/rngd",
+			expectedError:  false,
+		},
+		{
+			description:    "invalid custom name",
+			domain:         "furiosa.ai",
+			resourceNames:  []config.ResourceNameConfig{{Archs: []string{"rngd"}, Name: "NPU_Large"}},
+			arch:           smi.ArchRngd,
+			policy:         furiosa_device.NonePolicy,
+			expectedResult: "",
+			expectedError:  true,
+		},
+		{
+			description:    "invalid custom domain",
+			domain:         "furiosa.ai",
+			resourceNames:  []config.ResourceNameConfig{{Archs: []string{"rngd"}, Domain: "acme..com", Name: "npu"}},
+			arch:           smi.ArchRngd,
+			policy:         furiosa_device.NonePolicy,
+			expectedResult: "",
+			expectedError:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := config.NewDefaultConfig()
+			cfg.ResourceDomain = tc.domain
+			cfg.ResourceNames = tc.resourceNames
+
+			actualResult, actualErr := resolveResourceName(tc.arch, tc.policy, cfg)
+			if tc.expectedError {
+				assert.Error(t, actualErr)
+			} else {
+				assert.NoError(t, actualErr)
+			}
+
+			assert.Equal(t, tc.expectedResult, actualResult)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package device_manager
+
+import (
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+)
+
+// buildTopologyGroups groups the cards sharing a PCIe switch and returns the group keyed by uuid of the card.
+// A group is named after the lowest index of its cards, and a card whose links can't be read forms a group alone.
+func buildTopologyGroups(cards []smi.Device) (map[string]uint32, error) {
+	uuids := make([]string, len(cards))
+	groups := make(map[string]uint32, len(cards))
+
+	for i, card := range cards {
+		info, err := card.DeviceInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		uuids[i] = info.UUID()
+		groups[info.UUID()] = info.Index()
+	}
+
+	// merge the groups of every pair of cards under the same switch or the same socket.
+	for i := range cards {
+		for j := i + 1; j < len(cards); j++ {
+			linkType, err := cards[i].DeviceToDeviceLinkType(cards[j])
+			if err != nil || (linkType != smi.LinkTypeHostBridge && linkType != smi.LinkTypeNoc) {
+				continue
+			}
+
+			a, b := groups[uuids[i]], groups[uuids[j]]
+			group := min(a, b)
+			for uuid, g := range groups {
+				if g == a || g == b {
+					groups[uuid] = group
+				}
+			}
+		}
+	}
+
+	return groups, nil
+}
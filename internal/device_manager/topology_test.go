@@ -0,0 +1,53 @@
+package device_manager
+
+import (
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTopologyGroups(t *testing.T) {
+	tests := []struct {
+		description    string
+		cards          []int
+		expectedGroups map[string]uint32
+	}{
+		{
+			description: "cards sharing a switch",
+			cards:       []int{0, 1, 2, 3, 4, 5, 6, 7},
+			expectedGroups: map[string]uint32{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80": 0,
+				"A76AAD68-6855-40B1-9E86-D080852D1C81": 0,
+				"A76AAD68-6855-40B1-9E86-D080852D1C82": 2,
+				"A76AAD68-6855-40B1-9E86-D080852D1C83": 2,
+				"A76AAD68-6855-40B1-9E86-D080852D1C84": 4,
+				"A76AAD68-6855-40B1-9E86-D080852D1C85": 4,
+				"A76AAD68-6855-40B1-9E86-D080852D1C86": 6,
+				"A76AAD68-6855-40B1-9E86-D080852D1C87": 6,
+			},
+		},
+		{
+			description: "cards without a peer under the same switch",
+			cards:       []int{1, 2, 7},
+			expectedGroups: map[string]uint32{
+				"A76AAD68-6855-40B1-9E86-D080852D1C81": 1,
+				"A76AAD68-6855-40B1-9E86-D080852D1C82": 2,
+				"A76AAD68-6855-40B1-9E86-D080852D1C87": 7,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var cards []smi.Device
+			for _, idx := range tc.cards {
+				cards = append(cards, smi.GetStaticMockDevice(smi.ArchRngd, idx))
+			}
+
+			actual, err := buildTopologyGroups(cards)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedGroups, actual)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package health_checker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+)
+
+const (
+	temperatureCheckerName = "temperature"
+	throttlingCheckerName  = "throttling"
+	pcieLinkCheckerName    = "pcie-link"
+	coreStatusCheckerName  = "core-status"
+)
+
+var _ HealthChecker = (*temperatureChecker)(nil)
+
+type temperatureChecker struct {
+	socPeakThreshold float64
+}
+
+// NewTemperatureChecker reports a card as unhealthy when the peak SoC temperature exceeds the threshold in Celsius.
+func NewTemperatureChecker(socPeakThreshold float64) HealthChecker {
+	return &temperatureChecker{socPeakThreshold: socPeakThreshold}
+}
+
+func (t *temperatureChecker) Name() string {
+	return temperatureCheckerName
+}
+
+func (t *temperatureChecker) Check(device smi.Device) Result {
+	temperature, err := device.DeviceTemperature()
+	if err != nil {
+		return unhealthy(fmt.Sprintf("couldn't read temperature: %s", err))
+	}
+
+	if temperature.SocPeak() > t.socPeakThreshold {
+		return unhealthy(fmt.Sprintf("soc peak temperature %.1f°C exceeds %.1f°C", temperature.SocPeak(), t.socPeakThreshold))
+	}
+
+	return healthy()
+}
+
+var _ HealthChecker = (*throttlingChecker)(nil)
+
+type throttlingChecker struct {
+	duration time.Duration
+	now      func() time.Time
+
+	mu             sync.Mutex
+	throttledSince map[string]time.Time
+}
+
+// NewThrottlingChecker reports a card as unhealthy when it keeps throttling for longer than the given duration.
+// Throttling in idle state is not counted.
+func NewThrottlingChecker(duration time.Duration) HealthChecker {
+	return &throttlingChecker{
+		duration:       duration,
+		now:            time.Now,
+		throttledSince: make(map[string]time.Time),
+	}
+}
+
+func (t *throttlingChecker) Name() string {
+	return throttlingCheckerName
+}
+
+func (t *throttlingChecker) Check(device smi.Device) Result {
+	info, err := device.DeviceInfo()
+	if err != nil {
+		return unhealthy(fmt.Sprintf("couldn't read device info: %s", err))
+	}
+
+	reason, err := device.ThrottleReason()
+	if err != nil {
+		return unhealthy(fmt.Sprintf("couldn't read throttle reason: %s", err))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if reason == smi.ThrottleReasonNone || reason == smi.ThrottleReasonIdle {
+		delete(t.throttledSince, info.UUID())
+		return healthy()
+	}
+
+	now := t.now()
+	since, exist := t.throttledSince[info.UUID()]
+	if !exist {
+		since = now
+		t.throttledSince[info.UUID()] = since
+	}
+
+	if throttled := now.Sub(since); throttled >= t.duration {
+		return unhealthy(fmt.Sprintf("throttling by %s for %s", ThrottleReasonName(reason), throttled))
+	}
+
+	return healthy()
+}
+
+// ThrottleReasonName returns the name of the throttle reason in snake case, so that it can be a label value.
+func ThrottleReasonName(reason smi.ThrottleReason) string {
+	switch reason {
+	case smi.ThrottleReasonNone:
+		return "none"
+	case smi.ThrottleReasonIdle:
+		return "idle"
+	case smi.ThrottleReasonThermalSlowdown:
+		return "thermal_slowdown"
+	case smi.ThrottleReasonAppPowerCap:
+		return "app_power_cap"
+	case smi.ThrottleReasonAppClockCap:
+		return "app_clock_cap"
+	case smi.ThrottleReasonHwClockCap:
+		return "hw_clock_cap"
+	case smi.ThrottleReasonHwBusLimit:
+		return "hw_bus_limit"
+	case smi.ThrottleReasonHwPowerCap:
+		return "hw_power_cap"
+	default:
+		return "other"
+	}
+}
+
+var _ HealthChecker = (*pcieLinkChecker)(nil)
+
+type pcieLinkChecker struct {
+	minLinkWidth uint32
+	minLinkSpeed float64
+}
+
+// NewPcieLinkChecker reports a card as unhealthy when the PCIe link is trained below the given width and speed in GT/s.
+// The maximum capability of the link is used for zero values.
+func NewPcieLinkChecker(minLinkWidth uint32, minLinkSpeed float64) HealthChecker {
+	return &pcieLinkChecker{minLinkWidth: minLinkWidth, minLinkSpeed: minLinkSpeed}
+}
+
+func (p *pcieLinkChecker) Name() string {
+	return pcieLinkCheckerName
+}
+
+func (p *pcieLinkChecker) Check(device smi.Device) Result {
+	pcieInfo, err := device.PcieInfo()
+	if err != nil {
+		return unhealthy(fmt.Sprintf("couldn't read pcie info: %s", err))
+	}
+
+	linkInfo := pcieInfo.LinkInfo()
+
+	minLinkWidth := p.minLinkWidth
+	if minLinkWidth == 0 {
+		minLinkWidth = linkInfo.MaxLinkWidthCapability()
+	}
+
+	minLinkSpeed := p.minLinkSpeed
+	if minLinkSpeed == 0 {
+		minLinkSpeed = linkInfo.MaxLinkSpeedCapability()
+	}
+
+	if linkInfo.LinkWidthStatus() < minLinkWidth {
+		return unhealthy(fmt.Sprintf("pcie link width x%d is downtrained below x%d", linkInfo.LinkWidthStatus(), minLinkWidth))
+	}
+
+	if linkInfo.LinkSpeedStatus() < minLinkSpeed {
+		return unhealthy(fmt.Sprintf("pcie link speed %.1fGT/s is downtrained below %.1fGT/s", linkInfo.LinkSpeedStatus(), minLinkSpeed))
+	}
+
+	return healthy()
+}
+
+var _ HealthChecker = (*coreStatusChecker)(nil)
+
+type coreStatusChecker struct{}
+
+// NewCoreStatusChecker reports the PE cores in a state other than available and occupied as faulty.
+// Only the partitions containing the faulty cores are affected.
+func NewCoreStatusChecker() HealthChecker {
+	return &coreStatusChecker{}
+}
+
+func (c *coreStatusChecker) Name() string {
+	return coreStatusCheckerName
+}
+
+func (c *coreStatusChecker) Check(device smi.Device) Result {
+	coreStatuses, err := device.CoreStatus()
+	if err != nil {
+		return unhealthy(fmt.Sprintf("couldn't read core status: %s", err))
+	}
+
+	var faultyCores []uint32
+	for _, peStatus := range coreStatuses.PeStatus() {
+		if peStatus.Status() != smi.CoreStatusAvailable && peStatus.Status() != smi.CoreStatusOccupied {
+			faultyCores = append(faultyCores, peStatus.Core())
+		}
+	}
+
+	if len(faultyCores) > 0 {
+		return unhealthy(fmt.Sprintf("pe core(s) %v are in an unexpected state", faultyCores), faultyCores...)
+	}
+
+	return healthy()
+}
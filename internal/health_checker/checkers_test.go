@@ -0,0 +1,256 @@
+package health_checker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDevice overrides the signals of smi.Device read by the health checkers.
+type fakeDevice struct {
+	smi.Device
+	socPeak        float64
+	throttleReason smi.ThrottleReason
+	linkWidth      uint32
+	linkSpeed      float64
+	peStatus       []smi.PeStatus
+	err            error
+}
+
+func newFakeDevice() *fakeDevice {
+	return &fakeDevice{
+		Device:    smi.GetStaticMockDevices(smi.ArchRngd)[0],
+		socPeak:   40,
+		linkWidth: 16,
+		linkSpeed: 32,
+	}
+}
+
+func (f *fakeDevice) DeviceTemperature() (smi.DeviceTemperature, error) {
+	return fakeTemperature{socPeak: f.socPeak}, f.err
+}
+
+func (f *fakeDevice) ThrottleReason() (smi.ThrottleReason, error) {
+	return f.throttleReason, f.err
+}
+
+func (f *fakeDevice) PcieInfo() (smi.PcieInfo, error) {
+	return fakePcieInfo{link: fakeLinkInfo{width: f.linkWidth, speed: f.linkSpeed}}, f.err
+}
+
+func (f *fakeDevice) CoreStatus() (smi.CoreStatuses, error) {
+	return fakeCoreStatuses(f.peStatus), f.err
+}
+
+type fakeTemperature struct {
+	socPeak float64
+}
+
+func (f fakeTemperature) SocPeak() float64 { return f.socPeak }
+func (f fakeTemperature) Ambient() float64 { return 25 }
+
+type fakePcieInfo struct {
+	smi.PcieInfo
+	link fakeLinkInfo
+}
+
+func (f fakePcieInfo) LinkInfo() smi.PcieLinkInfo { return f.link }
+
+type fakeLinkInfo struct {
+	width uint32
+	speed float64
+}
+
+func (f fakeLinkInfo) PcieGenStatus() uint8            { return 5 }
+func (f fakeLinkInfo) LinkWidthStatus() uint32         { return f.width }
+func (f fakeLinkInfo) LinkSpeedStatus() float64        { return f.speed }
+func (f fakeLinkInfo) MaxLinkWidthCapability() uint32  { return 16 }
+func (f fakeLinkInfo) MaxLinkSpeedCapability() float64 { return 32 }
+
+type fakeCoreStatuses []smi.PeStatus
+
+func (f fakeCoreStatuses) PeStatus() []smi.PeStatus { return f }
+
+type fakePeStatus struct {
+	core   uint32
+	status smi.CoreStatus
+}
+
+func (f fakePeStatus) Core() uint32           { return f.core }
+func (f fakePeStatus) Status() smi.CoreStatus { return f.status }
+
+func TestTemperatureChecker(t *testing.T) {
+	tests := []struct {
+		description     string
+		socPeak         float64
+		err             error
+		expectedHealthy bool
+	}{
+		{
+			description:     "below threshold",
+			socPeak:         80,
+			expectedHealthy: true,
+		},
+		{
+			description:     "above threshold",
+			socPeak:         95.5,
+			expectedHealthy: false,
+		},
+		{
+			description:     "smi error",
+			err:             fmt.Errorf("smi error"),
+			expectedHealthy: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			device := newFakeDevice()
+			device.socPeak = tc.socPeak
+			device.err = tc.err
+
+			actual := NewTemperatureChecker(95).Check(device)
+			assert.Equal(t, tc.expectedHealthy, actual.Healthy, actual.Reason)
+		})
+	}
+}
+
+func TestThrottlingChecker(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		description     string
+		reasons         []smi.ThrottleReason
+		expectedHealthy []bool
+	}{
+		{
+			description:     "idle throttling is ignored",
+			reasons:         []smi.ThrottleReason{smi.ThrottleReasonIdle, smi.ThrottleReasonIdle, smi.ThrottleReasonIdle},
+			expectedHealthy: []bool{true, true, true},
+		},
+		{
+			description:     "persistent throttling",
+			reasons:         []smi.ThrottleReason{smi.ThrottleReasonThermalSlowdown, smi.ThrottleReasonThermalSlowdown, smi.ThrottleReasonHwPowerCap},
+			expectedHealthy: []bool{true, true, false},
+		},
+		{
+			description:     "throttling is interrupted",
+			reasons:         []smi.ThrottleReason{smi.ThrottleReasonThermalSlowdown, smi.ThrottleReasonNone, smi.ThrottleReasonThermalSlowdown},
+			expectedHealthy: []bool{true, true, true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			tick := 0
+			checker := NewThrottlingChecker(time.Minute).(*throttlingChecker)
+			checker.now = func() time.Time {
+				now := base.Add(time.Duration(tick) * 30 * time.Second)
+				tick++
+				return now
+			}
+
+			device := newFakeDevice()
+			for i, reason := range tc.reasons {
+				device.throttleReason = reason
+				actual := checker.Check(device)
+				assert.Equal(t, tc.expectedHealthy[i], actual.Healthy, "check %d: %s", i, actual.Reason)
+			}
+		})
+	}
+}
+
+func TestPcieLinkChecker(t *testing.T) {
+	tests := []struct {
+		description     string
+		minLinkWidth    uint32
+		minLinkSpeed    float64
+		linkWidth       uint32
+		linkSpeed       float64
+		expectedHealthy bool
+	}{
+		{
+			description:     "trained at max capability",
+			linkWidth:       16,
+			linkSpeed:       32,
+			expectedHealthy: true,
+		},
+		{
+			description:     "width downtrained below max capability",
+			linkWidth:       8,
+			linkSpeed:       32,
+			expectedHealthy: false,
+		},
+		{
+			description:     "speed downtrained below max capability",
+			linkWidth:       16,
+			linkSpeed:       16,
+			expectedHealthy: false,
+		},
+		{
+			description:     "downtrained within configured minimum",
+			minLinkWidth:    8,
+			minLinkSpeed:    16,
+			linkWidth:       8,
+			linkSpeed:       16,
+			expectedHealthy: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			device := newFakeDevice()
+			device.linkWidth = tc.linkWidth
+			device.linkSpeed = tc.linkSpeed
+
+			actual := NewPcieLinkChecker(tc.minLinkWidth, tc.minLinkSpeed).Check(device)
+			assert.Equal(t, tc.expectedHealthy, actual.Healthy, actual.Reason)
+		})
+	}
+}
+
+func TestCoreStatusChecker(t *testing.T) {
+	device := newFakeDevice()
+	device.peStatus = []smi.PeStatus{
+		fakePeStatus{core: 0, status: smi.CoreStatusAvailable},
+		fakePeStatus{core: 1, status: smi.CoreStatusOccupied},
+		fakePeStatus{core: 2, status: smi.CoreStatus(42)},
+		fakePeStatus{core: 3, status: smi.CoreStatusAvailable},
+	}
+
+	actual := NewCoreStatusChecker().Check(device)
+	assert.False(t, actual.Healthy)
+	assert.Equal(t, []uint32{2}, actual.Cores)
+	assert.False(t, actual.Affects(0, 1))
+	assert.True(t, actual.Affects(2, 3))
+
+	device.err = fmt.Errorf("smi error")
+	actual = NewCoreStatusChecker().Check(device)
+	assert.False(t, actual.Healthy)
+	assert.True(t, actual.Affects(0, 1))
+}
+
+func TestNewHealthCheckers(t *testing.T) {
+	cfg := config.NewDefaultConfig().HealthChecks
+	assert.Empty(t, NewHealthCheckers(cfg))
+
+	cfg.Temperature.Enabled = true
+	cfg.CoreStatus.Enabled = true
+
+	var names []string
+	for _, checker := range NewHealthCheckers(cfg) {
+		names = append(names, checker.Name())
+	}
+	assert.Equal(t, []string{"temperature", "core-status"}, names)
+}
+
+func TestCheckAll(t *testing.T) {
+	device := newFakeDevice()
+	device.socPeak = 100
+
+	assert.Empty(t, CheckAll(nil, device))
+	assert.Len(t, CheckAll([]HealthChecker{NewTemperatureChecker(95), NewPcieLinkChecker(0, 0)}, device), 1)
+}
@@ -0,0 +1,85 @@
+package health_checker
+
+import (
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+)
+
+// Result is the outcome of a health check of a card.
+type Result struct {
+	Healthy bool
+	// Reason explains why the card is unhealthy.
+	Reason string
+	// Cores are the PE cores affected by the failure, every core of the card is affected if it is empty.
+	Cores []uint32
+}
+
+// Affects reports whether the failure affects any PE core in the range from start to end.
+func (r Result) Affects(start uint32, end uint32) bool {
+	if r.Healthy {
+		return false
+	}
+
+	if len(r.Cores) == 0 {
+		return true
+	}
+
+	for _, core := range r.Cores {
+		if start <= core && core <= end {
+			return true
+		}
+	}
+
+	return false
+}
+
+func healthy() Result {
+	return Result{Healthy: true}
+}
+
+func unhealthy(reason string, cores ...uint32) Result {
+	return Result{Healthy: false, Reason: reason, Cores: cores}
+}
+
+// HealthChecker checks an aspect of the health of a card.
+// Liveness of the card is always checked by FuriosaDevice.IsHealthy, HealthChecker adds further signals on top of it.
+type HealthChecker interface {
+	Name() string
+	Check(device smi.Device) Result
+}
+
+// NewHealthCheckers returns the health checkers enabled by the configuration.
+func NewHealthCheckers(cfg config.HealthChecksConfig) []HealthChecker {
+	var checkers []HealthChecker
+
+	if cfg.Temperature.Enabled {
+		checkers = append(checkers, NewTemperatureChecker(cfg.Temperature.SocPeakThreshold))
+	}
+
+	if cfg.Throttling.Enabled {
+		checkers = append(checkers, NewThrottlingChecker(cfg.Throttling.Duration.Duration))
+	}
+
+	if cfg.PcieLink.Enabled {
+		checkers = append(checkers, NewPcieLinkChecker(cfg.PcieLink.MinLinkWidth, cfg.PcieLink.MinLinkSpeed))
+	}
+
+	if cfg.CoreStatus.Enabled {
+		checkers = append(checkers, NewCoreStatusChecker())
+	}
+
+	return checkers
+}
+
+// CheckAll runs every health checker against the card and returns the failures.
+func CheckAll(checkers []HealthChecker, device smi.Device) []Result {
+	var failures []Result
+
+	for _, checker := range checkers {
+		if result := checker.Check(device); !result.Healthy {
+			failures = append(failures, result)
+		}
+	}
+
+	return failures
+}
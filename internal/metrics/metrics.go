@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "furiosa_device_plugin"
+
+	// MetricsPath is the path serving the metrics in Prometheus text format.
+	MetricsPath = "/metrics"
+
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 5 * time.Second
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+
+	// StageInit is the initialization of the devices of the resource and their CDI spec, StageStart is the start of its
+	// plugin server, and StageUpdate is the update of the devices after they are rediscovered.
+	StageInit   = "init"
+	StageStart  = "start"
+	StageUpdate = "update"
+)
+
+var (
+	// Registry holds every metric of the device plugin.
+	Registry = prometheus.NewRegistry()
+
+	// RegisteredResources is 1 while the resource is registered to kubelet.
+	RegisteredResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "registered_resources",
+		Help:      "Whether the resource is registered to kubelet.",
+	}, []string{"resource"})
+
+	// Devices counts the devices of the resource by the reported health.
+	Devices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "devices",
+		Help:      "Number of devices advertised for the resource by health.",
+	}, []string{"resource", "health"})
+
+	// GrpcRequests counts the requests handled by the device plugin gRPC server.
+	GrpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Number of gRPC requests handled by the device plugin by method and status code.",
+	}, []string{"resource", "method", "code"})
+
+	// GrpcRequestDuration observes the latency of the unary requests.
+	GrpcRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Latency of the unary gRPC requests handled by the device plugin.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"resource", "method"})
+
+	// HealthCheckDuration observes the duration of a health check of every device of the resource.
+	HealthCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "health_check_duration_seconds",
+		Help:      "Duration of the health check of the devices of the resource.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"resource"})
+
+	// RegistrationAttempts counts the attempts to register the resource to kubelet.
+	RegistrationAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registration_attempts_total",
+		Help:      "Number of attempts to register the resource to kubelet by result.",
+	}, []string{"resource", "result"})
+
+	// ListAndWatchStreams is the number of open ListAndWatch streams of the resource.
+	ListAndWatchStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "list_and_watch_streams",
+		Help:      "Number of open ListAndWatch streams of the resource.",
+	}, []string{"resource"})
+
+	// ListAndWatchUpdates counts the ListAndWatch responses sent to kubelet.
+	ListAndWatchUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "list_and_watch_updates_total",
+		Help:      "Number of ListAndWatch responses sent to kubelet.",
+	}, []string{"resource"})
+
+	// UnknownArchDevices is 1 for each card of an architecture unknown to the device plugin.
+	// The resource is empty if the card is skipped.
+	UnknownArchDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unknown_arch_devices",
+		Help:      "Cards of architectures unknown to the device plugin and their fallback resource.",
+	}, []string{"uuid", "bdf", "arch_id", "resource"})
+
+	// FailedDevices is the number of the cards whose information couldn't be read, they are exposed under no resource.
+	FailedDevices = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "failed_devices",
+		Help:      "Number of cards skipped because their information couldn't be read.",
+	})
+
+	// ResourceFailures counts the failed attempts to serve the resource by the stage, see StageInit and StageStart.
+	ResourceFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resource_failures_total",
+		Help:      "Number of failed attempts to serve the resource by stage.",
+	}, []string{"resource", "stage"})
+
+	// ResourceRetrying is 1 while the resource failed to be served and is retried in the background.
+	ResourceRetrying = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "resource_retrying",
+		Help:      "Whether the resource failed to be served and is being retried.",
+	}, []string{"resource"})
+
+	// AllocationSearchExpirations counts the preferred allocations whose search exceeded the budget.
+	AllocationSearchExpirations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "allocation_search_expirations_total",
+		Help:      "Number of preferred allocations which returned the best allocation found within the search budget.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RegisteredResources,
+		Devices,
+		GrpcRequests,
+		GrpcRequestDuration,
+		HealthCheckDuration,
+		RegistrationAttempts,
+		ListAndWatchStreams,
+		ListAndWatchUpdates,
+		UnknownArchDevices,
+		FailedDevices,
+		ResourceFailures,
+		ResourceRetrying,
+		AllocationSearchExpirations,
+	)
+}
+
+// NewServeMux returns http.ServeMux serving the metrics at MetricsPath.
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+
+	return mux
+}
+
+// Serve serves the handler on the listener until the context is done.
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
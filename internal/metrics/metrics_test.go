@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe(t *testing.T) {
+	RegisteredResources.WithLabelValues("furiosa.ai/rngd").Set(1)
+	Devices.WithLabelValues("furiosa.ai/rngd", "Healthy").Set(8)
+	UnknownArchDevices.WithLabelValues("A76AAD68-6855-40B1-9E86-D080852D1C87", "0000:ca:00.0", "99", "").Set(1)
+	ResourceFailures.WithLabelValues("furiosa.ai/rngd-max", StageInit).Inc()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, listener, NewServeMux())
+	}()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + MetricsPath)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, expected := range []string{
+		`furiosa_device_plugin_registered_resources{resource="furiosa.ai/rngd"} 1`,
+		`furiosa_device_plugin_devices{health="Healthy",resource="furiosa.ai/rngd"} 8`,
+		`furiosa_device_plugin_unknown_arch_devices{arch_id="99",bdf="0000:ca:00.0",resource="",uuid="A76AAD68-6855-40B1-9E86-D080852D1C87"} 1`,
+		`furiosa_device_plugin_resource_failures_total{resource="furiosa.ai/rngd-max",stage="init"} 1`,
+		"go_goroutines",
+	} {
+		assert.True(t, strings.Contains(string(body), expected), expected)
+	}
+
+	// the server is stopped gracefully when the context is done.
+	cancel()
+	assert.NoError(t, <-served)
+}
@@ -0,0 +1,163 @@
+package node_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	serviceHostEnv   = "KUBERNETES_SERVICE_HOST"
+	servicePortEnv   = "KUBERNETES_SERVICE_PORT"
+	serviceAccountCA = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	//nolint:gosec
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	nodePathExp           = "/api/v1/nodes/%s"
+	mergePatchContentType = "application/merge-patch+json"
+	requestTimeout        = 10 * time.Second
+)
+
+// NodeClient accesses the Node object of the node running the device plugin.
+// It talks to the API server directly with the in-cluster service account to avoid depending on client-go.
+type NodeClient interface {
+	NodeName() string
+	GetNodeMetadata(ctx context.Context) (*metav1.PartialObjectMetadata, error)
+	PatchNodeLabels(ctx context.Context, labels map[string]*string) error
+}
+
+var _ NodeClient = (*nodeClient)(nil)
+
+type nodeClient struct {
+	baseURL    string
+	token      string
+	nodeName   string
+	httpClient *http.Client
+}
+
+// NewInClusterNodeClient builds NodeClient using the service account mounted into the pod.
+func NewInClusterNodeClient(nodeName string) (NodeClient, error) {
+	host, port := os.Getenv(serviceHostEnv), os.Getenv(servicePortEnv)
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("couldn't find the api server address, %s and %s must be set", serviceHostEnv, servicePortEnv)
+	}
+
+	token, err := os.ReadFile(serviceAccountToken)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read service account token: %w", err)
+	}
+
+	caCert, err := os.ReadFile(serviceAccountCA)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read service account ca certificate: %w", err)
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("couldn't parse service account ca certificate %s", serviceAccountCA)
+	}
+
+	httpClient := &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    caPool,
+				MinVersion: tls.VersionTLS12,
+			},
+		},
+	}
+
+	return newNodeClient("https://"+net.JoinHostPort(host, port), string(token), nodeName, httpClient), nil
+}
+
+func newNodeClient(baseURL string, token string, nodeName string, httpClient *http.Client) NodeClient {
+	return &nodeClient{
+		baseURL:    baseURL,
+		token:      token,
+		nodeName:   nodeName,
+		httpClient: httpClient,
+	}
+}
+
+func (n *nodeClient) NodeName() string {
+	return n.nodeName
+}
+
+func (n *nodeClient) GetNodeMetadata(ctx context.Context) (*metav1.PartialObjectMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.nodeURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := n.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &metav1.PartialObjectMetadata{}
+	if err = json.Unmarshal(body, metadata); err != nil {
+		return nil, fmt.Errorf("couldn't decode node %s: %w", n.nodeName, err)
+	}
+
+	return metadata, nil
+}
+
+// PatchNodeLabels sets the labels of the node with a JSON merge patch, the label with nil value is removed.
+func (n *nodeClient) PatchNodeLabels(ctx context.Context, labels map[string]*string) error {
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": labels}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, n.nodeURL(), bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mergePatchContentType)
+
+	_, err = n.do(req)
+	return err
+}
+
+func (n *nodeClient) nodeURL() string {
+	return n.baseURL + fmt.Sprintf(nodePathExp, url.PathEscape(n.nodeName))
+}
+
+// do sends the request about the node and returns the body of the successful response.
+func (n *nodeClient) do(req *http.Request) ([]byte, error) {
+	req.Header.Set("Accept", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't %s node %s: %w", strings.ToLower(req.Method), n.nodeName, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't %s node %s: unexpected status %s: %s", strings.ToLower(req.Method), n.nodeName, resp.Status, string(body))
+	}
+
+	return body, nil
+}
@@ -0,0 +1,112 @@
+package node_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetNodeMetadata(t *testing.T) {
+	tests := []struct {
+		description         string
+		status              int
+		body                string
+		expectedAnnotations map[string]string
+		expectError         bool
+	}{
+		{
+			description:         "get annotations of the node",
+			status:              http.StatusOK,
+			body:                `{"kind": "Node", "apiVersion": "v1", "metadata": {"name": "node0", "annotations": {"furiosa.ai/blocked-devices": "0,1"}}, "status": {}}`,
+			expectedAnnotations: map[string]string{"furiosa.ai/blocked-devices": "0,1"},
+			expectError:         false,
+		},
+		{
+			description:         "forbidden",
+			status:              http.StatusForbidden,
+			body:                `{"kind": "Status", "reason": "Forbidden"}`,
+			expectedAnnotations: nil,
+			expectError:         true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/v1/nodes/node0", r.URL.Path)
+				assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := newNodeClient(server.URL, "token", "node0", server.Client())
+			actual, err := client.GetNodeMetadata(context.Background())
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "node0", actual.Name)
+			assert.Equal(t, tc.expectedAnnotations, actual.Annotations)
+		})
+	}
+}
+
+func TestPatchNodeLabels(t *testing.T) {
+	count := "2"
+
+	tests := []struct {
+		description   string
+		status        int
+		labels        map[string]*string
+		expectedPatch string
+		expectError   bool
+	}{
+		{
+			description:   "set and remove labels",
+			status:        http.StatusOK,
+			labels:        map[string]*string{"furiosa.ai/unknown-arch-devices": &count, "furiosa.ai/stale": nil},
+			expectedPatch: `{"metadata":{"labels":{"furiosa.ai/stale":null,"furiosa.ai/unknown-arch-devices":"2"}}}`,
+			expectError:   false,
+		},
+		{
+			description:   "forbidden",
+			status:        http.StatusForbidden,
+			labels:        map[string]*string{"furiosa.ai/unknown-arch-devices": &count},
+			expectedPatch: `{"metadata":{"labels":{"furiosa.ai/unknown-arch-devices":"2"}}}`,
+			expectError:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPatch, r.Method)
+				assert.Equal(t, "/api/v1/nodes/node0", r.URL.Path)
+				assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tc.expectedPatch, string(body))
+
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(`{"kind": "Node", "apiVersion": "v1", "metadata": {"name": "node0"}}`))
+			}))
+			defer server.Close()
+
+			client := newNodeClient(server.URL, "token", "node0", server.Client())
+			err := client.PatchNodeLabels(context.Background(), tc.labels)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
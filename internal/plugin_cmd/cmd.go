@@ -3,13 +3,25 @@ package plugin_cmd
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/cdi_reconciler"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
 	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
-	"github.com/furiosa-ai/furiosa-device-plugin/internal/server"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/node_client"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/pod_resources"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/telemetry"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
@@ -17,10 +29,16 @@ import (
 )
 
 const (
-	cmdUse       = "furiosa-device-plugin"
-	cmdShort     = "Furiosa Device Plugin for Kubernetes"
-	cmdExample   = "furiosa-device-plugin"
-	debugModeExp = "debugMode"
+	cmdUse     = "furiosa-device-plugin"
+	cmdShort   = "Furiosa Device Plugin for Kubernetes"
+	cmdExample = "furiosa-device-plugin --config /etc/furiosa-device-plugin/config.yaml"
+	configExp  = "config"
+
+	// unknownArchDevicesLabel is the node label holding the number of the cards of unknown architectures.
+	unknownArchDevicesLabel = "furiosa.ai/unknown-arch-devices"
+
+	// rediscoveryDelay is the delay of the rediscovery after the last change of the device nodes.
+	rediscoveryDelay = time.Second
 )
 
 func NewDevicePluginCommand() *cobra.Command {
@@ -30,17 +48,23 @@ func NewDevicePluginCommand() *cobra.Command {
 		Example: cmdExample,
 		Args:    cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			debugMode, _ := cmd.Flags().GetBool(debugModeExp)
-			return start(cmd.Context(), debugMode)
+			configPath, _ := cmd.Flags().GetString(configExp)
+			cfg, err := config.Load(configPath, os.LookupEnv, cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			return start(cmd.Context(), cfg)
 		},
 	}
 
-	devicePluginCmd.Flags().Bool(debugModeExp, false, "enable debug logging")
+	devicePluginCmd.Flags().String(configExp, "", "path to the configuration file in YAML or JSON format")
+	config.AddFlags(devicePluginCmd.Flags())
 
 	return devicePluginCmd
 }
 
-func start(ctx context.Context, debugMode bool) error {
+func start(ctx context.Context, cfg *config.Config) error {
 	// create core loop logger
 	logger := zerolog.New(os.Stdout).With().Timestamp().Str("subject", "core_loop").Logger()
 	_ = logger.WithContext(ctx)
@@ -63,6 +87,7 @@ func start(ctx context.Context, debugMode bool) error {
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
 	//grpc server panic listener
+	// it is never closed, the handlers still running after the plugin servers are stopped may report to it.
 	grpcErrChan := make(chan error, 1)
 
 	defer func() {
@@ -70,56 +95,144 @@ func start(ctx context.Context, debugMode bool) error {
 		_ = fsWatcher.Close()
 		signal.Stop(sigChan)
 		close(sigChan)
-		close(grpcErrChan)
 	}()
 
-	deviceMap, err := device_manager.BuildDeviceMap(logger)
+	discovery, err := device_manager.BuildDeviceMap(logger, cfg)
 	if err != nil {
 		logger.Err(err).Msg("couldn't build device-map with device-api")
 		return err
 	}
 
-	var pluginServers []server.PluginServer
+	reportUnknownArchDevices(ctx, logger, cfg, discovery.UnknownArchDevices)
+	metrics.FailedDevices.Set(float64(len(discovery.FailedDevices)))
+
+	blockedDeviceSelectors, err := loadBlockedDeviceSelectors(ctx, cfg)
+	if err != nil {
+		logger.Err(err).Msg("couldn't load blocked devices")
+		return err
+	}
 
-	if len(deviceMap) == 0 {
+	if len(discovery.DeviceMap) == 0 {
 		noDeviceError := fmt.Errorf("couldn't recognize any furiosa devices")
 		logger.Err(noDeviceError).Msg("If this is not a NPU node, please deploy this plugin on NPU nodes only by tolerations or nodeSelector.")
 		return noDeviceError
 	}
 
-	for arch, devices := range deviceMap {
-		//FIXME(@bg): handle unknown arch case
-		deviceManager, err := device_manager.NewDeviceManager(arch, devices, debugMode)
+	// a resource failing to be served is retried in the background, so that the other resources keep serving.
+	pluginServers := newPluginServerGroup(cfg, grpcErrChan, func(key device_manager.DeviceGroupKey, devices []smi.Device, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) (device_manager.DeviceManager, error) {
+		deviceManager, err := device_manager.NewDeviceManager(key.ResourceName, key.Policy, devices, blockedDeviceSelectors, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't initialize device manager for %s with %s partitioning policy: %w", key.ResourceName, key.Policy, err)
+		}
+
+		for uuid, reason := range deviceManager.BlockedDevices() {
+			logger.Warn().Msg(fmt.Sprintf("device %s of %s is excluded and will be reported as unhealthy: %s", uuid, deviceManager.ResourceName(), reason))
+		}
+
+		return deviceManager, nil
+	})
+	// the CDI spec is written before the devices are advertised, so that the CDI devices returned by Allocate resolve.
+	if cfg.DeviceInjection.UsesCDI() {
+		reconciler := cdi_reconciler.NewReconciler(cfg.CDISpecDir, pluginServers.furiosaDevices)
+		pluginServers.prepareDevices = func() error {
+			return reconcileCDISpec(logger, reconciler)
+		}
+
+		// the reconciler removes the spec when it returns, wait for it so that no spec is left behind.
+		reconcilerCtx, reconcilerCancel := context.WithCancel(ctx)
+		reconcilerDone := make(chan struct{})
+		go func() {
+			reconciler.Run(reconcilerCtx, logger, cfg.HealthCheckInterval.Duration)
+			close(reconcilerDone)
+		}()
+		defer func() {
+			reconcilerCancel()
+			<-reconcilerDone
+		}()
+	}
+
+	pluginServers.sync(logger, discovery, blockedDeviceSelectors)
+
+	mux := metrics.NewServeMux()
+	mux.Handle(statusPath, newStatusHandler(pluginServers))
+
+	var podResources pod_resources.Client
+	if cfg.PodResources.Enabled {
+		podResources, err = pod_resources.NewClient(cfg.PodResources.SocketPath, pluginServers.resourceNames)
 		if err != nil {
-			logger.Err(err).Msg(fmt.Sprintf("couldn't initialize device manager for %s arch", arch.ToString()))
+			logger.Err(err).Msg("couldn't create pod resources client")
+			_ = pluginServers.stop()
 			return err
 		}
-		logger.Info().Msg(fmt.Sprintf("starting new plugin server for %s", deviceManager.ResourceName()))
+		defer func() {
+			_ = podResources.Close()
+		}()
+
+		mux.Handle(pod_resources.HandlerPath, pod_resources.NewHandler(podResources))
+	}
 
-		newPluginServerCtx, newPluginServerCancelFunc := context.WithCancel(context.Background())
-		newPluginServerLogger := zerolog.New(os.Stdout).With().Timestamp().Str("subject", "plugin_server_"+deviceManager.ResourceName()).Logger()
-		newPluginServerCtx = newPluginServerLogger.WithContext(newPluginServerCtx)
+	var observer *telemetry.CardsObserver
+	if cfg.Telemetry.Enabled {
+		var observerErr error
+		observer, observerErr = telemetry.NewCardsObserver(pluginServers.cards(), cfg.Telemetry.UtilizationInterval.Duration)
+		if observerErr != nil {
+			logger.Warn().Msg(fmt.Sprintf("couldn't create observer, utilization of the PE cores won't be exported until the cards change: %s", observerErr))
+		}
+		defer observer.Destroy()
 
-		pluginServer := server.NewPluginServerWithContext(newPluginServerCtx, newPluginServerCancelFunc, deviceManager, debugMode)
-		if err = startServerWithContext(newPluginServerCtx, pluginServer, grpcErrChan); err != nil {
-			logger.Err(err).Msg(fmt.Sprintf("couldn't start plugin server for %s", deviceManager.ResourceName()))
+		if err = metrics.Registry.Register(telemetry.NewCollector(pluginServers.cards, observer, podResources)); err != nil {
+			logger.Err(err).Msg("couldn't register telemetry collector")
+			_ = pluginServers.stop()
 			return err
 		}
+	}
 
-		pluginServers = append(pluginServers, pluginServer)
+	if cfg.MetricsAddress != "" {
+		if err = startMetricsServer(ctx, logger, cfg.MetricsAddress, mux); err != nil {
+			logger.Err(err).Msg(fmt.Sprintf("couldn't listen metrics address %s", cfg.MetricsAddress))
+			_ = pluginServers.stop()
+			return err
+		}
+	}
+
+	// the cards are rediscovered periodically, and shortly after the device nodes are changed, e.g. by hot-plug.
+	var rediscoveryTicker <-chan time.Time
+	if cfg.DeviceDiscovery.Interval.Duration > 0 {
+		ticker := time.NewTicker(cfg.DeviceDiscovery.Interval.Duration)
+		defer ticker.Stop()
+		rediscoveryTicker = ticker.C
+	}
+
+	for _, watchPath := range cfg.DeviceDiscovery.WatchPaths {
+		if watchErr := fsWatcher.Add(watchPath); watchErr != nil {
+			logger.Warn().Msg(fmt.Sprintf("couldn't watch the device nodes at %s, the cards are rediscovered periodically only: %s", watchPath, watchErr))
+		}
 	}
 
+	rediscoveryTimer := time.NewTimer(rediscoveryDelay)
+	rediscoveryTimer.Stop()
+	defer rediscoveryTimer.Stop()
+
 	logger.Info().Msg("start event loop")
 
 Loop:
 	for {
 		select {
+		case <-rediscoveryTicker:
+			discovery, blockedDeviceSelectors = rediscoverDevices(ctx, logger, cfg, pluginServers, discovery, blockedDeviceSelectors)
+			updateObserver(logger, observer, pluginServers)
+		case <-rediscoveryTimer.C:
+			discovery, blockedDeviceSelectors = rediscoverDevices(ctx, logger, cfg, pluginServers, discovery, blockedDeviceSelectors)
+			updateObserver(logger, observer, pluginServers)
 		case fsEvent := <-fsWatcher.Events:
 			// Note(@bg): the device-plugin should be re-registered to kubelet if the kubelet is restarted.
 			// https://kubernetes.io/docs/concepts/extend-kubernetes/compute-storage-net/device-plugins/#handling-kubelet-restarts
 			if fsEvent.Name == devicePluginAPIv1Beta1.KubeletSocket && fsEvent.Has(fsnotify.Create) {
-				logger.Err(err).Msg("kubelet socket is newly created, the device plugin should be restarted.")
-				break Loop
+				logger.Info().Msg("kubelet socket is newly created, re-registering the plugin servers.")
+				pluginServers.restart(logger)
+			} else if isWatchedDevicePath(fsEvent.Name, cfg.DeviceDiscovery.WatchPaths) {
+				// a hot-plugged card creates several device nodes at once, so the rediscovery waits for them.
+				rediscoveryTimer.Reset(rediscoveryDelay)
 			}
 		case sig := <-sigChan:
 			logger.Err(err).Msg(fmt.Sprintf("signal %d recevied.", sig))
@@ -131,18 +244,155 @@ Loop:
 	}
 
 	logger.Info().Msg("stopping pluginServers")
-	for _, pluginServer := range pluginServers {
-		if err := stopServer(pluginServer); err != nil {
-			return err
+	if stopErr := pluginServers.stop(); stopErr != nil {
+		return stopErr
+	}
+
+	return err
+}
+
+// loadBlockedDeviceSelectors collects selectors of blocked cards from the configuration and the node annotation.
+func loadBlockedDeviceSelectors(ctx context.Context, cfg *config.Config) ([]device_manager.BlockedDeviceSelector, error) {
+	selectors := device_manager.NewBlockedDeviceSelectors(device_manager.BlockSourceConfig, cfg.BlockedDevices...)
+	if cfg.BlockedDevicesNodeAnnotation == "" {
+		return selectors, nil
+	}
+
+	nodeClient, err := node_client.NewInClusterNodeClient(cfg.NodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := nodeClient.GetNodeMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if value, exist := metadata.Annotations[cfg.BlockedDevicesNodeAnnotation]; exist {
+		selectors = append(selectors, device_manager.ParseBlockedDevicesAnnotation(cfg.BlockedDevicesNodeAnnotation, value)...)
+	}
+
+	return selectors, nil
+}
+
+// rediscoverDevices lists the cards and reads the blocked cards again, applies them to the plugin servers, and returns
+// them. The previous ones are kept if they can't be read.
+func rediscoverDevices(ctx context.Context, logger zerolog.Logger, cfg *config.Config, pluginServers *pluginServerGroup, previous device_manager.Discovery, previousSelectors []device_manager.BlockedDeviceSelector) (device_manager.Discovery, []device_manager.BlockedDeviceSelector) {
+	blockedDeviceSelectors, err := loadBlockedDeviceSelectors(ctx, cfg)
+	if err != nil {
+		logger.Err(err).Msg("couldn't reload blocked devices, the previous blocked devices are kept")
+		blockedDeviceSelectors = previousSelectors
+	}
+
+	discovery, err := device_manager.RebuildDeviceMap(logger, cfg)
+	if err != nil {
+		logger.Err(err).Msg("couldn't rediscover the devices, the previous devices are kept")
+		discovery = previous
+	}
+
+	if !slices.Equal(discovery.UnknownArchDevices, previous.UnknownArchDevices) {
+		reportUnknownArchDevices(ctx, logger, cfg, discovery.UnknownArchDevices)
+	}
+	metrics.FailedDevices.Set(float64(len(discovery.FailedDevices)))
+
+	pluginServers.sync(logger, discovery, blockedDeviceSelectors)
+	return discovery, blockedDeviceSelectors
+}
+
+// updateObserver lets the observer sample the utilization of the rediscovered cards, if the telemetry is enabled.
+func updateObserver(logger zerolog.Logger, observer *telemetry.CardsObserver, pluginServers *pluginServerGroup) {
+	if observer == nil {
+		return
+	}
+
+	if err := observer.Update(pluginServers.cards()); err != nil {
+		logger.Warn().Msg(fmt.Sprintf("couldn't recreate observer for the rediscovered cards, the previous observer is kept: %s", err))
+	}
+}
+
+// isWatchedDevicePath returns whether the path is in one of the watched directories of the device nodes.
+func isWatchedDevicePath(path string, watchPaths []string) bool {
+	for _, watchPath := range watchPaths {
+		if filepath.Dir(path) == filepath.Clean(watchPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reportUnknownArchDevices surfaces the cards of unknown architectures through the logs, the metrics and the node label.
+func reportUnknownArchDevices(ctx context.Context, logger zerolog.Logger, cfg *config.Config, devices []device_manager.UnknownArchDevice) {
+	// the cards reported before may be gone when the cards are rediscovered.
+	metrics.UnknownArchDevices.Reset()
+	for _, device := range devices {
+		if device.ResourceName == "" {
+			logger.Warn().Msg(fmt.Sprintf("device %s at %s has unknown arch %d and is skipped", device.UUID, device.BDF, device.Arch))
+		} else {
+			logger.Warn().Msg(fmt.Sprintf("device %s at %s has unknown arch %d and is registered as %s", device.UUID, device.BDF, device.Arch, device.ResourceName))
 		}
+
+		metrics.UnknownArchDevices.WithLabelValues(device.UUID, device.BDF, strconv.FormatUint(uint64(device.Arch), 10), device.ResourceName).Set(1)
+	}
+
+	if !cfg.UnknownArch.LabelNode {
+		return
 	}
 
+	// the label is removed if every card is known, so that a stale label doesn't remain after the plugin is upgraded.
+	var count *string
+	if len(devices) > 0 {
+		value := strconv.Itoa(len(devices))
+		count = &value
+	}
+
+	nodeClient, err := node_client.NewInClusterNodeClient(cfg.NodeName)
+	if err == nil {
+		err = nodeClient.PatchNodeLabels(ctx, map[string]*string{unknownArchDevicesLabel: count})
+	}
+
+	if err != nil {
+		logger.Warn().Msg(fmt.Sprintf("couldn't label node %s with the devices of unknown archs: %s", cfg.NodeName, err))
+	}
+}
+
+// reconcileCDISpec rewrites the CDI spec to match the devices, so that the container runtime can resolve the CDI devices
+// returned by Allocate. A spec left on disk by a previous run, which may be stale if the device plugin crashed, is
+// rewritten before the first device is advertised.
+func reconcileCDISpec(logger zerolog.Logger, reconciler *cdi_reconciler.Reconciler) error {
+	diff, err := reconciler.Reconcile()
+	if err != nil {
+		return fmt.Errorf("couldn't write cdi spec %s: %w", reconciler.Path(), err)
+	}
+
+	if !diff.Empty() {
+		logger.Info().Msg(fmt.Sprintf("cdi spec %s is rewritten: %s", reconciler.Path(), diff))
+	}
+
+	return nil
+}
+
+// startMetricsServer serves the metrics in the background until the context is done.
+// The device plugin keeps working even if the metrics server fails after start.
+func startMetricsServer(ctx context.Context, logger zerolog.Logger, address string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().Msg(fmt.Sprintf("serving metrics at %s%s", listener.Addr(), metrics.MetricsPath))
+	go func() {
+		if serveErr := metrics.Serve(ctx, listener, handler); serveErr != nil {
+			logger.Err(serveErr).Msg("metrics server is stopped")
+		}
+	}()
+
 	return nil
 }
 
-func startServerWithContext(ctx context.Context, server server.PluginServer, grpcErrChan chan error) error {
+func startServerWithContext(ctx context.Context, server pluginServer, grpcErrChan chan error) error {
 	return server.StartWithContext(ctx, grpcErrChan)
 }
-func stopServer(server server.PluginServer) error {
+func stopServer(server pluginServer) error {
 	return server.Stop()
 }
@@ -15,11 +15,19 @@ Usage:
   furiosa-device-plugin [flags]
 
 Examples:
-furiosa-device-plugin
+furiosa-device-plugin --config /etc/furiosa-device-plugin/config.yaml
 
 Flags:
-      --debugMode   enable debug logging
-  -h, --help        help for furiosa-device-plugin
+      --allocator string             preferred allocation strategy, one of score-based, bin-packing, branch-and-bound, single-numa and spread
+      --config string                path to the configuration file in YAML or JSON format
+      --debugMode                    enable debug logging
+      --deviceInjection string       how the devices are injected into the containers, one of legacy, cdi and both
+      --healthCheckInterval string   interval of the device health check, e.g. 5s
+  -h, --help                         help for furiosa-device-plugin
+      --metricsAddress string        address serving the metrics in Prometheus text format, e.g. :9400, disabled if empty
+      --nodeName string              name of the node running the device plugin
+      --partitioningPolicy string    partitioning policy of the devices, one of none, single-core, dual-core and quad-core
+      --resourceDomain string        domain of the extended resource names
 `
 )
 
@@ -64,3 +72,37 @@ func TestDevicePluginCommand(t *testing.T) {
 		assert.Equal(t, strings.TrimSpace(tc.expectedResult), strings.TrimSpace(output))
 	}
 }
+
+func TestIsWatchedDevicePath(t *testing.T) {
+	tests := []struct {
+		description    string
+		path           string
+		watchPaths     []string
+		expectedResult bool
+	}{
+		{
+			description:    "device node in the watched directory",
+			path:           "/dev/rngd/npu8pe0",
+			watchPaths:     []string{"/dev/rngd/"},
+			expectedResult: true,
+		},
+		{
+			description:    "kubelet socket",
+			path:           "/var/lib/kubelet/device-plugins/kubelet.sock",
+			watchPaths:     []string{"/dev/rngd"},
+			expectedResult: false,
+		},
+		{
+			description:    "no watched directory",
+			path:           "/dev/rngd/npu8pe0",
+			watchPaths:     nil,
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedResult, isWatchedDevicePath(tc.path, tc.watchPaths))
+		})
+	}
+}
@@ -0,0 +1,486 @@
+package plugin_cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/server"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// resourceRetryBackoff retries a resource which failed to be served until the device plugin is stopped.
+var resourceRetryBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      5 * time.Minute,
+}
+
+// The states of ResourceStatus.
+const (
+	ResourcePending  = "pending"
+	ResourceServing  = "serving"
+	ResourceRetrying = "retrying"
+)
+
+// ResourceStatus is the state of serving a resource.
+type ResourceStatus struct {
+	Resource string `json:"resource"`
+	State    string `json:"state"`
+	// Attempts is the number of the attempts to serve the resource, including the successful one.
+	Attempts int `json:"attempts"`
+	// LastError is the error of the last attempt, it is empty once the resource is served.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// deviceManagerFactory creates the DeviceManager of the devices of a resource.
+type deviceManagerFactory func(key device_manager.DeviceGroupKey, devices []smi.Device, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) (device_manager.DeviceManager, error)
+
+// pluginServer is the lifecycle of server.PluginServer used by pluginServerGroup.
+type pluginServer interface {
+	StartWithContext(ctx context.Context, grpcErrChan chan error) error
+	Stop() error
+	NotifyDevicesChanged()
+}
+
+// pluginServerFactory creates a new pluginServer serving the given DeviceManager with its own context.
+type pluginServerFactory func(deviceManager device_manager.DeviceManager, cfg *config.Config) (context.Context, pluginServer)
+
+func newPluginServer(deviceManager device_manager.DeviceManager, cfg *config.Config) (context.Context, pluginServer) {
+	newPluginServerCtx, newPluginServerCancelFunc := context.WithCancel(context.Background())
+	newPluginServerLogger := zerolog.New(os.Stdout).With().Timestamp().Str("subject", "plugin_server_"+deviceManager.ResourceName()).Logger()
+	newPluginServerCtx = newPluginServerLogger.WithContext(newPluginServerCtx)
+
+	pluginServer := server.NewPluginServerWithContext(newPluginServerCtx, newPluginServerCancelFunc, deviceManager, cfg)
+	return newPluginServerCtx, &pluginServer
+}
+
+// servedResource is a resource of pluginServerGroup.
+type servedResource struct {
+	key     device_manager.DeviceGroupKey
+	devices []smi.Device
+	// deviceManager is nil until the devices are initialized, and pluginServer is nil until it is started.
+	deviceManager device_manager.DeviceManager
+	pluginServer  pluginServer
+	status        ResourceStatus
+	// ctx is cancelled when the resource is removed or the group is stopped, which stops the retries of the resource.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// pluginServerGroup runs a plugin server per resource.
+// DeviceManagers outlive plugin servers, so device states are kept when the plugin servers are recreated.
+// A resource which fails to be served is retried in the background without affecting the other resources.
+type pluginServerGroup struct {
+	cfg              *config.Config
+	grpcErrChan      chan error
+	factory          pluginServerFactory
+	newDeviceManager deviceManagerFactory
+	retryBackoff     wait.Backoff
+	retryCtx         context.Context
+	retryCancel      context.CancelFunc
+	retries          sync.WaitGroup
+	// prepareDevices is called before the devices of the initialized resources are advertised to kubelet, e.g. to write
+	// the CDI spec resolving the devices returned by Allocate. It is nil if nothing depends on the devices.
+	prepareDevices func() error
+
+	// opMu serializes the changes of the resources, i.e. the attempts to serve, sync, restart and stop.
+	opMu sync.Mutex
+	// blockedDeviceSelectors is changed only while opMu is held.
+	blockedDeviceSelectors []device_manager.BlockedDeviceSelector
+	// mu guards the fields below and the fields of the resources read by the CDI reconciler, the telemetry and the
+	// status endpoint. They are changed only while opMu is held.
+	mu        sync.Mutex
+	resources map[string]*servedResource
+	discovery device_manager.Discovery
+}
+
+func newPluginServerGroup(cfg *config.Config, grpcErrChan chan error, newDeviceManager deviceManagerFactory) *pluginServerGroup {
+	retryCtx, retryCancel := context.WithCancel(context.Background())
+	return &pluginServerGroup{
+		cfg:              cfg,
+		grpcErrChan:      grpcErrChan,
+		factory:          newPluginServer,
+		newDeviceManager: newDeviceManager,
+		retryBackoff:     resourceRetryBackoff,
+		retryCtx:         retryCtx,
+		retryCancel:      retryCancel,
+		resources:        make(map[string]*servedResource),
+	}
+}
+
+// sync serves the resources of the discovery with the blocked cards, it is called at startup and whenever the cards are
+// rediscovered. The DeviceManagers of the existing resources are updated in place and their plugin servers report the
+// changed devices to kubelet once they are prepared, and the plugin servers of the resources appearing or disappearing
+// are started or stopped.
+// A resource which fails to be served is retried in the background until it is served, removed or the group is stopped.
+func (g *pluginServerGroup) sync(logger zerolog.Logger, discovery device_manager.Discovery, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) {
+	g.opMu.Lock()
+	g.blockedDeviceSelectors = blockedDeviceSelectors
+
+	g.mu.Lock()
+	g.discovery = discovery
+	g.mu.Unlock()
+
+	keys := make(map[string]device_manager.DeviceGroupKey, len(discovery.DeviceMap))
+	for key := range discovery.DeviceMap {
+		keys[key.ResourceName] = key
+	}
+
+	// a resource whose partitioning policy is changed is recreated, since its devices are not the same anymore.
+	removed := false
+	for resourceName, resource := range g.resources {
+		if key, exist := keys[resourceName]; !exist || key != resource.key {
+			g.remove(logger, resource)
+			removed = true
+		}
+	}
+
+	var added, changed []*servedResource
+	for key, devices := range discovery.DeviceMap {
+		if resource, exist := g.resources[key.ResourceName]; exist {
+			if g.update(logger, resource, devices) {
+				changed = append(changed, resource)
+			}
+			continue
+		}
+
+		added = append(added, g.register(key, devices))
+	}
+
+	// the devices are prepared again before kubelet is told about the changed ones, which also drops the removed ones.
+	// The devices of the added resources are prepared when they are served.
+	if g.prepareDevices != nil && (removed || len(changed) > 0) {
+		if err := g.prepareDevices(); err != nil {
+			logger.Err(err).Msg("couldn't prepare the rediscovered devices")
+		}
+	}
+
+	for _, resource := range changed {
+		if resource.pluginServer != nil {
+			resource.pluginServer.NotifyDevicesChanged()
+		}
+	}
+
+	g.opMu.Unlock()
+
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].key.ResourceName < added[j].key.ResourceName
+	})
+	for _, resource := range added {
+		logger.Info().Msg(fmt.Sprintf("starting new plugin server for %s", resource.key.ResourceName))
+		g.serve(logger, resource)
+	}
+}
+
+// register adds a new resource to the group, which is served by serve.
+func (g *pluginServerGroup) register(key device_manager.DeviceGroupKey, devices []smi.Device) *servedResource {
+	ctx, cancel := context.WithCancel(g.retryCtx)
+	resource := &servedResource{
+		key:     key,
+		devices: devices,
+		status:  ResourceStatus{Resource: key.ResourceName, State: ResourcePending},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	g.mu.Lock()
+	g.resources[key.ResourceName] = resource
+	g.mu.Unlock()
+
+	return resource
+}
+
+// update replaces the devices and the blocked cards of the resource, and returns whether the devices are changed, so
+// that its plugin server reports them to kubelet again.
+func (g *pluginServerGroup) update(logger zerolog.Logger, resource *servedResource, devices []smi.Device) bool {
+	resourceName := resource.key.ResourceName
+	resource.devices = devices
+
+	// the devices are initialized at the next attempt if the resource is being retried.
+	if resource.deviceManager == nil {
+		return false
+	}
+
+	changed, err := resource.deviceManager.Update(devices, g.blockedDeviceSelectors)
+	if err != nil {
+		metrics.ResourceFailures.WithLabelValues(resourceName, metrics.StageUpdate).Inc()
+		logger.Err(err).Msg(fmt.Sprintf("couldn't update the devices of %s, the previous devices are kept", resourceName))
+		return false
+	}
+
+	if changed {
+		logger.Info().Msg(fmt.Sprintf("devices of %s are changed, %d device(s) are advertised", resourceName, len(resource.deviceManager.Devices())))
+	}
+
+	return changed
+}
+
+// remove stops the plugin server of the resource and its retries, and forgets the resource.
+func (g *pluginServerGroup) remove(logger zerolog.Logger, resource *servedResource) {
+	resourceName := resource.key.ResourceName
+	resource.cancel()
+	if resource.pluginServer != nil {
+		_ = stopServer(resource.pluginServer)
+	}
+
+	g.mu.Lock()
+	delete(g.resources, resourceName)
+	g.mu.Unlock()
+
+	metrics.ResourceRetrying.DeleteLabelValues(resourceName)
+	metrics.Devices.DeletePartialMatch(prometheus.Labels{"resource": resourceName})
+	logger.Info().Msg(fmt.Sprintf("devices of %s are gone, the plugin server is stopped", resourceName))
+}
+
+// serve makes the first attempt to serve the resource, and retries it with exponential back-off in the background if it fails.
+func (g *pluginServerGroup) serve(logger zerolog.Logger, resource *servedResource) {
+	if g.attempt(logger, resource) {
+		return
+	}
+
+	g.retry(logger, resource, false)
+}
+
+// retry attempts to serve the resource in the background with exponential back-off until it is served, the first attempt
+// is made without waiting if immediate is true.
+func (g *pluginServerGroup) retry(logger zerolog.Logger, resource *servedResource, immediate bool) {
+	g.retries.Add(1)
+	go func() {
+		defer g.retries.Done()
+
+		if immediate && g.attempt(logger, resource) {
+			return
+		}
+
+		backoff := g.retryBackoff
+		for {
+			select {
+			case <-resource.ctx.Done():
+				return
+			case <-time.After(backoff.Step()):
+			}
+
+			if g.attempt(logger, resource) {
+				return
+			}
+		}
+	}()
+}
+
+// attempt initializes the devices of the resource unless they are initialized, prepares them and starts its plugin server.
+// It returns false if the attempt should be retried.
+// The DeviceManager is created once, so only the plugin server is restarted if the devices are initialized.
+func (g *pluginServerGroup) attempt(logger zerolog.Logger, resource *servedResource) bool {
+	g.opMu.Lock()
+	defer g.opMu.Unlock()
+
+	// the resource is removed or the group is stopped.
+	if resource.ctx.Err() != nil {
+		return true
+	}
+
+	stage := metrics.StageInit
+	var err error
+	if resource.deviceManager == nil {
+		var deviceManager device_manager.DeviceManager
+		if deviceManager, err = g.newDeviceManager(resource.key, resource.devices, g.blockedDeviceSelectors); err == nil {
+			g.mu.Lock()
+			resource.deviceManager = deviceManager
+			g.mu.Unlock()
+		}
+	}
+
+	if resource.deviceManager != nil && g.prepareDevices != nil {
+		err = g.prepareDevices()
+	}
+
+	if resource.deviceManager != nil && err == nil {
+		stage = metrics.StageStart
+		err = g.start(resource)
+	}
+
+	return g.record(logger, resource, stage, err)
+}
+
+// start starts a new plugin server for the DeviceManager of the resource.
+func (g *pluginServerGroup) start(resource *servedResource) error {
+	ctx, pluginServer := g.factory(resource.deviceManager, g.cfg)
+	if err := startServerWithContext(ctx, pluginServer, g.grpcErrChan); err != nil {
+		_ = stopServer(pluginServer)
+		return err
+	}
+
+	g.mu.Lock()
+	resource.pluginServer = pluginServer
+	g.mu.Unlock()
+	return nil
+}
+
+// record updates the status of the resource with the result of an attempt to serve it, and returns whether it is served.
+func (g *pluginServerGroup) record(logger zerolog.Logger, resource *servedResource, stage string, err error) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	resourceName := resource.key.ResourceName
+	status := &resource.status
+	status.Attempts++
+
+	if err != nil {
+		status.State = ResourceRetrying
+		status.LastError = err.Error()
+		metrics.ResourceFailures.WithLabelValues(resourceName, stage).Inc()
+		metrics.ResourceRetrying.WithLabelValues(resourceName).Set(1)
+		logger.Err(err).Msg(fmt.Sprintf("couldn't %s %s at attempt %d, it will be retried while the other resources keep serving", stage, resourceName, status.Attempts))
+		return false
+	}
+
+	status.State = ResourceServing
+	status.LastError = ""
+	metrics.ResourceRetrying.WithLabelValues(resourceName).Set(0)
+	logger.Info().Msg(fmt.Sprintf("plugin server for %s is started at attempt %d", resourceName, status.Attempts))
+	return true
+}
+
+// sortedResources returns the resources ordered by the resource name, g.mu must be held.
+func (g *pluginServerGroup) sortedResources() []*servedResource {
+	resources := make([]*servedResource, 0, len(g.resources))
+	for _, resource := range g.resources {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].key.ResourceName < resources[j].key.ResourceName
+	})
+
+	return resources
+}
+
+// furiosaDevices returns the devices of every initialized resource.
+func (g *pluginServerGroup) furiosaDevices() []furiosa_device.FuriosaDevice {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var devices []furiosa_device.FuriosaDevice
+	for _, resource := range g.sortedResources() {
+		if resource.deviceManager != nil {
+			devices = append(devices, resource.deviceManager.FuriosaDevices()...)
+		}
+	}
+
+	return devices
+}
+
+// cards returns the cards of every initialized resource.
+func (g *pluginServerGroup) cards() []device_manager.Card {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var cards []device_manager.Card
+	for _, resource := range g.sortedResources() {
+		if resource.deviceManager != nil {
+			cards = append(cards, resource.deviceManager.Cards()...)
+		}
+	}
+
+	return cards
+}
+
+// resourceNames returns the names of every resource including the ones being retried.
+func (g *pluginServerGroup) resourceNames() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var resourceNames []string
+	for _, resource := range g.sortedResources() {
+		resourceNames = append(resourceNames, resource.key.ResourceName)
+	}
+
+	return resourceNames
+}
+
+// resourceStatuses returns the status of every resource ordered by the resource name.
+func (g *pluginServerGroup) resourceStatuses() []ResourceStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	statuses := make([]ResourceStatus, 0, len(g.resources))
+	for _, resource := range g.sortedResources() {
+		statuses = append(statuses, resource.status)
+	}
+
+	return statuses
+}
+
+// restart recreates every plugin server to listen on a new socket and register to the restarted kubelet.
+// The plugin servers are re-registered in the background and retried like the ones failing to be served, so that
+// registering to a kubelet which isn't ready doesn't block the caller. The resources being retried aren't affected.
+func (g *pluginServerGroup) restart(logger zerolog.Logger) {
+	g.opMu.Lock()
+
+	g.mu.Lock()
+	resources := g.sortedResources()
+	g.mu.Unlock()
+
+	var stopped []*servedResource
+	for _, resource := range resources {
+		if resource.pluginServer == nil {
+			continue
+		}
+
+		_ = stopServer(resource.pluginServer)
+		g.mu.Lock()
+		resource.pluginServer = nil
+		resource.status.State = ResourcePending
+		g.mu.Unlock()
+		stopped = append(stopped, resource)
+	}
+
+	g.opMu.Unlock()
+
+	for _, resource := range stopped {
+		logger.Info().Msg(fmt.Sprintf("re-registering plugin server for %s to kubelet", resource.key.ResourceName))
+		g.retry(logger, resource, true)
+	}
+}
+
+// stop cancels the retries in the background and stops every plugin server.
+func (g *pluginServerGroup) stop() error {
+	g.retryCancel()
+	g.retries.Wait()
+
+	g.opMu.Lock()
+	defer g.opMu.Unlock()
+
+	g.mu.Lock()
+	resources := g.sortedResources()
+	g.mu.Unlock()
+
+	for _, resource := range resources {
+		if resource.pluginServer == nil {
+			continue
+		}
+
+		if err := stopServer(resource.pluginServer); err != nil {
+			return err
+		}
+
+		g.mu.Lock()
+		resource.pluginServer = nil
+		g.mu.Unlock()
+	}
+
+	return nil
+}
@@ -0,0 +1,384 @@
+package plugin_cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type fakePluginServer struct {
+	deviceManager device_manager.DeviceManager
+	startErr      error
+	// wait blocks the start until it is closed if it is not nil, like registering to kubelet which isn't ready.
+	wait     chan struct{}
+	started  bool
+	stopped  bool
+	notified int
+}
+
+func (f *fakePluginServer) StartWithContext(_ context.Context, _ chan error) error {
+	if f.wait != nil {
+		<-f.wait
+	}
+
+	f.started = f.startErr == nil
+	return f.startErr
+}
+
+func (f *fakePluginServer) Stop() error {
+	f.stopped = true
+	return nil
+}
+
+func (f *fakePluginServer) NotifyDevicesChanged() {
+	f.notified++
+}
+
+// fakePluginServerFactory creates a healthy initial server and fails to start the next failures servers.
+type fakePluginServerFactory struct {
+	failures int
+	created  []*fakePluginServer
+}
+
+func (f *fakePluginServerFactory) newPluginServer(deviceManager device_manager.DeviceManager, _ *config.Config) (context.Context, pluginServer) {
+	server := &fakePluginServer{deviceManager: deviceManager}
+	if len(f.created) > 0 && len(f.created) <= f.failures {
+		server.startErr = fmt.Errorf("kubelet is not ready")
+	}
+
+	f.created = append(f.created, server)
+	return context.Background(), server
+}
+
+// newDeviceManager creates the DeviceManager of the mock devices without blocked devices.
+func newDeviceManager(key device_manager.DeviceGroupKey, devices []smi.Device, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) (device_manager.DeviceManager, error) {
+	return device_manager.NewDeviceManager(key.ResourceName, key.Policy, devices, blockedDeviceSelectors, config.NewDefaultConfig())
+}
+
+// discoveryOf returns the discovery of the resources of the devices without partitioning.
+func discoveryOf(resources map[string][]smi.Device) device_manager.Discovery {
+	deviceMap := make(device_manager.DeviceMap)
+	for resourceName, devices := range resources {
+		deviceMap[device_manager.DeviceGroupKey{ResourceName: resourceName, Policy: furiosa_device.NonePolicy}] = devices
+	}
+
+	return device_manager.Discovery{DeviceMap: deviceMap}
+}
+
+func TestPluginServerGroupRestart(t *testing.T) {
+	tests := []struct {
+		description string
+		// failures is the number of the failed re-registrations of furiosa.ai/rngd-max, -1 if it keeps failing.
+		failures      int
+		expectedState string
+	}{
+		{
+			description:   "re-register every resource at the first attempt",
+			failures:      0,
+			expectedState: ResourceServing,
+		},
+		{
+			description:   "re-register after retries in the background",
+			failures:      2,
+			expectedState: ResourceServing,
+		},
+		{
+			description:   "keep re-registering the other resources while one keeps failing",
+			failures:      -1,
+			expectedState: ResourceRetrying,
+		},
+	}
+
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var mu sync.Mutex
+			created := make(map[string][]*fakePluginServer)
+			release := make(chan struct{})
+
+			group := newPluginServerGroup(config.NewDefaultConfig(), make(chan error, 1), newDeviceManager)
+			group.retryBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: math.MaxInt32}
+			group.factory = func(deviceManager device_manager.DeviceManager, _ *config.Config) (context.Context, pluginServer) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				resourceName := deviceManager.ResourceName()
+				server := &fakePluginServer{deviceManager: deviceManager}
+				restarts := len(created[resourceName])
+				if restarts > 0 {
+					server.wait = release
+				}
+				if resourceName == "furiosa.ai/rngd-max" && restarts > 0 && (tc.failures < 0 || restarts <= tc.failures) {
+					server.startErr = fmt.Errorf("kubelet is not ready")
+				}
+
+				created[resourceName] = append(created[resourceName], server)
+				return context.Background(), server
+			}
+
+			group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{
+				"furiosa.ai/rngd":     mockDevices[:4],
+				"furiosa.ai/rngd-max": mockDevices[4:],
+			}), nil)
+
+			// restart returns without waiting for the re-registrations.
+			restarted := make(chan struct{})
+			go func() {
+				group.restart(zerolog.Nop())
+				close(restarted)
+			}()
+			select {
+			case <-restarted:
+			case <-time.After(time.Second):
+				assert.Fail(t, "restart is blocked by the re-registrations")
+			}
+			close(release)
+
+			assert.Eventually(t, func() bool {
+				statuses := group.resourceStatuses()
+				return statuses[0].State == ResourceServing && statuses[1].State == tc.expectedState && statuses[1].Attempts > tc.failures+1
+			}, time.Second, time.Millisecond)
+
+			assert.NoError(t, group.stop())
+
+			// the initial servers are stopped and replaced by the servers of the same DeviceManagers.
+			for resourceName, servers := range created {
+				assert.True(t, servers[0].started, resourceName)
+				assert.True(t, servers[0].stopped, resourceName)
+				for _, server := range servers[1:] {
+					assert.Equal(t, servers[0].deviceManager, server.deviceManager, resourceName)
+				}
+			}
+
+			assert.Len(t, created["furiosa.ai/rngd"], 2)
+			assert.True(t, created["furiosa.ai/rngd"][1].started)
+
+			last := created["furiosa.ai/rngd-max"][len(created["furiosa.ai/rngd-max"])-1]
+			assert.Equal(t, tc.failures >= 0, last.started)
+			if tc.failures >= 0 {
+				assert.Len(t, created["furiosa.ai/rngd-max"], tc.failures+2)
+			}
+		})
+	}
+}
+
+func TestPluginServerGroupServe(t *testing.T) {
+	tests := []struct {
+		description      string
+		initFailures     int
+		startFailures    int
+		prepareFailures  int
+		expectedAttempts int
+		expectedInits    int
+		expectedPrepares int
+	}{
+		{
+			description:      "serve at the first attempt",
+			expectedAttempts: 1,
+			expectedInits:    1,
+			expectedPrepares: 1,
+		},
+		{
+			description:      "retry the initialization of the devices",
+			initFailures:     2,
+			expectedAttempts: 3,
+			expectedInits:    3,
+			expectedPrepares: 1,
+		},
+		{
+			description:      "retry the start of the plugin server without initializing the devices again",
+			startFailures:    2,
+			expectedAttempts: 3,
+			expectedInits:    1,
+			expectedPrepares: 3,
+		},
+		{
+			description:      "retry the preparation of the devices without starting the plugin server",
+			prepareFailures:  2,
+			expectedAttempts: 3,
+			expectedInits:    1,
+			expectedPrepares: 3,
+		},
+	}
+
+	cfg := config.NewDefaultConfig()
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var created []*fakePluginServer
+			inits := 0
+			group := newPluginServerGroup(cfg, make(chan error, 1), func(key device_manager.DeviceGroupKey, devices []smi.Device, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) (device_manager.DeviceManager, error) {
+				inits++
+				if inits <= tc.initFailures {
+					return nil, fmt.Errorf("device is not ready")
+				}
+
+				return newDeviceManager(key, devices, blockedDeviceSelectors)
+			})
+			prepares := 0
+			prepared := false
+			group.prepareDevices = func() error {
+				prepares++
+				// the devices are prepared after they are initialized.
+				assert.Len(t, group.furiosaDevices(), 8)
+				if prepares <= tc.prepareFailures {
+					return fmt.Errorf("cdi spec is not writable")
+				}
+
+				prepared = true
+				return nil
+			}
+			group.retryBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 10}
+			group.factory = func(deviceManager device_manager.DeviceManager, _ *config.Config) (context.Context, pluginServer) {
+				// the plugin server is started only after the devices are prepared.
+				assert.True(t, prepared)
+				server := &fakePluginServer{deviceManager: deviceManager}
+				if len(created) < tc.startFailures {
+					server.startErr = fmt.Errorf("kubelet is not ready")
+				}
+
+				created = append(created, server)
+				return context.Background(), server
+			}
+
+			group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": smi.GetStaticMockDevices(smi.ArchRngd)}), nil)
+
+			assert.Eventually(t, func() bool {
+				statuses := group.resourceStatuses()
+				return len(statuses) == 1 && statuses[0].State == ResourceServing
+			}, time.Second, time.Millisecond)
+			assert.Equal(t, []ResourceStatus{{Resource: "furiosa.ai/rngd", State: ResourceServing, Attempts: tc.expectedAttempts}}, group.resourceStatuses())
+			assert.Len(t, group.furiosaDevices(), 8)
+
+			assert.NoError(t, group.stop())
+			assert.Equal(t, tc.expectedInits, inits)
+			assert.Equal(t, tc.expectedPrepares, prepares)
+			assert.Len(t, created, tc.startFailures+1)
+			assert.True(t, created[len(created)-1].started)
+			assert.True(t, created[len(created)-1].stopped)
+		})
+	}
+}
+
+func TestPluginServerGroupServeDegraded(t *testing.T) {
+	factory := &fakePluginServerFactory{}
+	group := newPluginServerGroup(config.NewDefaultConfig(), make(chan error, 1), func(key device_manager.DeviceGroupKey, devices []smi.Device, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) (device_manager.DeviceManager, error) {
+		if key.ResourceName == "furiosa.ai/rngd-max" {
+			return nil, fmt.Errorf("device is not ready")
+		}
+
+		return newDeviceManager(key, devices, blockedDeviceSelectors)
+	})
+	group.factory = factory.newPluginServer
+	group.retryBackoff = wait.Backoff{Duration: time.Hour, Factor: 1, Steps: 1}
+
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{
+		"furiosa.ai/rngd":     mockDevices[:4],
+		"furiosa.ai/rngd-max": mockDevices[4:],
+	}), nil)
+
+	// the healthy resource keeps serving while the failed one waits for the next attempt.
+	assert.Equal(t, []ResourceStatus{
+		{Resource: "furiosa.ai/rngd", State: ResourceServing, Attempts: 1},
+		{Resource: "furiosa.ai/rngd-max", State: ResourceRetrying, Attempts: 1, LastError: "device is not ready"},
+	}, group.resourceStatuses())
+	assert.Equal(t, []string{"furiosa.ai/rngd", "furiosa.ai/rngd-max"}, group.resourceNames())
+	assert.Len(t, group.furiosaDevices(), 4)
+	assert.Len(t, factory.created, 1)
+	assert.True(t, factory.created[0].started)
+
+	// stop cancels the pending retry without waiting for the back-off.
+	assert.NoError(t, group.stop())
+	assert.True(t, factory.created[0].stopped)
+}
+
+func TestPluginServerGroupSync(t *testing.T) {
+	factory := &fakePluginServerFactory{}
+	group := newPluginServerGroup(config.NewDefaultConfig(), make(chan error, 1), newDeviceManager)
+	group.factory = factory.newPluginServer
+
+	// preparations records the number of the devices and the notifications to kubelet at every preparation.
+	var preparations [][2]int
+	group.prepareDevices = func() error {
+		notified := 0
+		for _, server := range factory.created {
+			notified += server.notified
+		}
+
+		preparations = append(preparations, [2]int{len(group.furiosaDevices()), notified})
+		return nil
+	}
+
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices[:6]}), nil)
+	assert.Len(t, factory.created, 1)
+	rngd := factory.created[0]
+	assert.Len(t, group.furiosaDevices(), 6)
+
+	// the same cards don't make an update.
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices[:6]}), nil)
+	assert.Equal(t, 0, rngd.notified)
+
+	// hot-plugged cards are added to the running resource.
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices}), nil)
+	assert.Len(t, factory.created, 1)
+	assert.Equal(t, 1, rngd.notified)
+	// the hot-plugged devices are prepared before they are reported to kubelet.
+	assert.Equal(t, [2]int{8, 0}, preparations[len(preparations)-1])
+	assert.Len(t, rngd.deviceManager.Devices(), 8)
+	assert.Len(t, group.cards(), 8)
+
+	// a new resource is started, and the cards moved to it are removed from the existing resource.
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{
+		"furiosa.ai/rngd":     mockDevices[:4],
+		"furiosa.ai/rngd-max": mockDevices[4:],
+	}), nil)
+	assert.Len(t, factory.created, 2)
+	rngdMax := factory.created[1]
+	assert.True(t, rngdMax.started)
+	assert.Equal(t, 2, rngd.notified)
+	assert.Len(t, rngd.deviceManager.Devices(), 4)
+	assert.Len(t, rngdMax.deviceManager.Devices(), 4)
+	assert.Len(t, group.furiosaDevices(), 8)
+
+	// the cards blocked by the node annotation are applied to the running resource, and unblocked again.
+	blocked := device_manager.ParseBlockedDevicesAnnotation("furiosa.ai/blocked-devices", "A76AAD68-6855-40B1-9E86-D080852D1C85")
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{
+		"furiosa.ai/rngd":     mockDevices[:4],
+		"furiosa.ai/rngd-max": mockDevices[4:],
+	}), blocked)
+	assert.Equal(t, 1, rngdMax.notified)
+	assert.Contains(t, rngdMax.deviceManager.BlockedDevices(), "A76AAD68-6855-40B1-9E86-D080852D1C85")
+
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{
+		"furiosa.ai/rngd":     mockDevices[:4],
+		"furiosa.ai/rngd-max": mockDevices[4:],
+	}), nil)
+	assert.Equal(t, 2, rngdMax.notified)
+	assert.Empty(t, rngdMax.deviceManager.BlockedDevices())
+
+	// the plugin server of the resource without devices is stopped.
+	group.sync(zerolog.Nop(), discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd-max": mockDevices[4:]}), nil)
+	assert.True(t, rngd.stopped)
+	assert.False(t, rngdMax.stopped)
+	assert.Equal(t, []string{"furiosa.ai/rngd-max"}, group.resourceNames())
+	assert.Len(t, group.furiosaDevices(), 4)
+	// the devices of the stopped plugin server are dropped by the preparation.
+	assert.Equal(t, 4, preparations[len(preparations)-1][0])
+
+	assert.NoError(t, group.stop())
+	assert.True(t, rngdMax.stopped)
+}
@@ -0,0 +1,58 @@
+package plugin_cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+)
+
+// statusPath is the path of the local endpoint reporting whether every resource and card is served.
+const statusPath = "/status"
+
+// Status is the state of the device plugin served at statusPath.
+type Status struct {
+	// Degraded is true if a resource is being retried or a card is skipped because it couldn't be read.
+	Degraded           bool                               `json:"degraded"`
+	Resources          []ResourceStatus                   `json:"resources"`
+	FailedDevices      []device_manager.FailedDevice      `json:"failedDevices,omitempty"`
+	UnknownArchDevices []device_manager.UnknownArchDevice `json:"unknownArchDevices,omitempty"`
+}
+
+// status returns Status of the resources and the last discovery of the cards.
+func (g *pluginServerGroup) status() Status {
+	statuses := g.resourceStatuses()
+
+	g.mu.Lock()
+	discovery := g.discovery
+	g.mu.Unlock()
+
+	status := Status{
+		Degraded:           len(discovery.FailedDevices) > 0,
+		Resources:          statuses,
+		FailedDevices:      discovery.FailedDevices,
+		UnknownArchDevices: discovery.UnknownArchDevices,
+	}
+	for _, resource := range status.Resources {
+		if resource.State != ResourceServing {
+			status.Degraded = true
+		}
+	}
+
+	return status
+}
+
+// newStatusHandler returns http.Handler reporting Status in JSON.
+// It responds with 200 even if degraded, so that a probe doesn't restart the healthy resources.
+func newStatusHandler(pluginServers *pluginServerGroup) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pluginServers.status())
+	})
+}
@@ -0,0 +1,94 @@
+package plugin_cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestStatusHandler(t *testing.T) {
+	newGroup := func(discovery device_manager.Discovery) *pluginServerGroup {
+		factory := &fakePluginServerFactory{}
+		group := newPluginServerGroup(config.NewDefaultConfig(), make(chan error, 1), func(key device_manager.DeviceGroupKey, devices []smi.Device, blockedDeviceSelectors []device_manager.BlockedDeviceSelector) (device_manager.DeviceManager, error) {
+			if key.ResourceName == "furiosa.ai/rngd-max" {
+				return nil, fmt.Errorf("device is not ready")
+			}
+
+			return newDeviceManager(key, devices, blockedDeviceSelectors)
+		})
+		group.factory = factory.newPluginServer
+		group.retryBackoff = wait.Backoff{Duration: time.Hour, Factor: 1, Steps: 1}
+		group.sync(zerolog.Nop(), discovery, nil)
+
+		return group
+	}
+
+	mockDevices := smi.GetStaticMockDevices(smi.ArchRngd)
+	withFailures := discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices[:7]})
+	withFailures.FailedDevices = []device_manager.FailedDevice{{Position: 3, Error: "device is not responding"}}
+	withFailures.UnknownArchDevices = []device_manager.UnknownArchDevice{
+		{UUID: "A76AAD68-6855-40B1-9E86-D080852D1C87", BDF: "0000:ca:00.0", Arch: smi.Arch(99)},
+	}
+
+	tests := []struct {
+		description    string
+		method         string
+		discovery      device_manager.Discovery
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:    "every resource is served",
+			method:         http.MethodGet,
+			discovery:      discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices}),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"degraded":false,"resources":[{"resource":"furiosa.ai/rngd","state":"serving","attempts":1}]}`,
+		},
+		{
+			description:    "a resource is being retried",
+			method:         http.MethodGet,
+			discovery:      discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices[:4], "furiosa.ai/rngd-max": mockDevices[4:]}),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"degraded":true,"resources":[{"resource":"furiosa.ai/rngd","state":"serving","attempts":1},{"resource":"furiosa.ai/rngd-max","state":"retrying","attempts":1,"lastError":"device is not ready"}]}`,
+		},
+		{
+			description:    "a card couldn't be read",
+			method:         http.MethodGet,
+			discovery:      withFailures,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"degraded":true,"resources":[{"resource":"furiosa.ai/rngd","state":"serving","attempts":1}],"failedDevices":[{"position":3,"error":"device is not responding"}],"unknownArchDevices":[{"uuid":"A76AAD68-6855-40B1-9E86-D080852D1C87","bdf":"0000:ca:00.0","arch":99}]}`,
+		},
+		{
+			description:    "reject other methods",
+			method:         http.MethodPost,
+			discovery:      discoveryOf(map[string][]smi.Device{"furiosa.ai/rngd": mockDevices}),
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			group := newGroup(tc.discovery)
+			defer func() {
+				_ = group.stop()
+			}()
+
+			recorder := httptest.NewRecorder()
+			newStatusHandler(group).ServeHTTP(recorder, httptest.NewRequest(tc.method, statusPath, nil))
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
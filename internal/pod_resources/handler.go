@@ -0,0 +1,60 @@
+package pod_resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	// HandlerPath is the path of the local endpoint answering which container holds a device.
+	HandlerPath = "/pod-resources"
+
+	deviceQuery = "device"
+)
+
+// Allocation is a device and the container holding it.
+type Allocation struct {
+	DeviceID string `json:"deviceID"`
+	Owner
+}
+
+// NewHandler returns http.Handler listing the allocated devices and their owners in JSON.
+// A single device can be queried with the "device" query parameter, e.g. /pod-resources?device=<device id>.
+func NewHandler(client Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		owners, err := client.Owners(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		allocations := make([]Allocation, 0, len(owners))
+		for deviceID, owner := range owners {
+			allocations = append(allocations, Allocation{DeviceID: deviceID, Owner: owner})
+		}
+		sort.Slice(allocations, func(i, j int) bool {
+			return allocations[i].DeviceID < allocations[j].DeviceID
+		})
+
+		var body interface{} = allocations
+		if r.URL.Query().Has(deviceQuery) {
+			deviceID := r.URL.Query().Get(deviceQuery)
+			owner, exist := owners[deviceID]
+			if !exist {
+				http.Error(w, fmt.Sprintf("device %s is not allocated", deviceID), http.StatusNotFound)
+				return
+			}
+			body = Allocation{DeviceID: deviceID, Owner: owner}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	})
+}
@@ -0,0 +1,102 @@
+package pod_resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	podResourcesAPIv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	// maxMessageSize is large enough to list the resources of every pod on a node.
+	maxMessageSize = 16 * 1024 * 1024
+)
+
+// Owner is the container holding a device.
+type Owner struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+}
+
+// Client maps the devices allocated by kubelet to the containers holding them.
+type Client interface {
+	// Owners returns the owner of every allocated device of the resources keyed by device id.
+	Owners(ctx context.Context) (map[string]Owner, error)
+	Close() error
+}
+
+var _ Client = (*client)(nil)
+
+type client struct {
+	conn          *grpc.ClientConn
+	lister        podResourcesAPIv1.PodResourcesListerClient
+	resourceNames func() []string
+}
+
+// NewClient builds Client talking to the kubelet PodResources API listening on the unix socket.
+// Only the devices of the resources returned by resourceNames at each call are returned, so that the resources added
+// after startup are included. Every resource is returned if resourceNames is nil or returns no name.
+// The connection is established lazily, so that the device plugin starts even if the API is not ready yet.
+func NewClient(socketPath string, resourceNames func() []string) (Client, error) {
+	conn, err := grpc.NewClient("unix://"+socketPath,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create pod resources client for %s: %w", socketPath, err)
+	}
+
+	return &client{
+		conn:          conn,
+		lister:        podResourcesAPIv1.NewPodResourcesListerClient(conn),
+		resourceNames: resourceNames,
+	}, nil
+}
+
+func (c *client) Owners(ctx context.Context) (map[string]Owner, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	resp, err := c.lister.List(ctx, &podResourcesAPIv1.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list pod resources: %w", err)
+	}
+
+	names := make(map[string]struct{})
+	if c.resourceNames != nil {
+		for _, resourceName := range c.resourceNames() {
+			names[resourceName] = struct{}{}
+		}
+	}
+
+	owners := make(map[string]Owner)
+	for _, pod := range resp.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			for _, devices := range container.GetDevices() {
+				if _, exist := names[devices.GetResourceName()]; len(names) > 0 && !exist {
+					continue
+				}
+
+				for _, deviceID := range devices.GetDeviceIds() {
+					owners[deviceID] = Owner{
+						Namespace: pod.GetNamespace(),
+						Pod:       pod.GetName(),
+						Container: container.GetName(),
+					}
+				}
+			}
+		}
+	}
+
+	return owners, nil
+}
+
+func (c *client) Close() error {
+	return c.conn.Close()
+}
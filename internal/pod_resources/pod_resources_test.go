@@ -0,0 +1,204 @@
+package pod_resources
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	podResourcesAPIv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+var _ podResourcesAPIv1.PodResourcesListerServer = (*fakePodResourcesServer)(nil)
+
+type fakePodResourcesServer struct {
+	podResourcesAPIv1.UnimplementedPodResourcesListerServer
+	podResources []*podResourcesAPIv1.PodResources
+}
+
+func (f *fakePodResourcesServer) List(_ context.Context, _ *podResourcesAPIv1.ListPodResourcesRequest) (*podResourcesAPIv1.ListPodResourcesResponse, error) {
+	return &podResourcesAPIv1.ListPodResourcesResponse{PodResources: f.podResources}, nil
+}
+
+// startFakePodResourcesServer serves the fake PodResources API on a unix socket and returns the path of the socket.
+func startFakePodResourcesServer(t *testing.T, podResources []*podResourcesAPIv1.PodResources) string {
+	socketPath := filepath.Join(t.TempDir(), "kubelet.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	server := grpc.NewServer()
+	podResourcesAPIv1.RegisterPodResourcesListerServer(server, &fakePodResourcesServer{podResources: podResources})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return socketPath
+}
+
+func TestOwners(t *testing.T) {
+	socketPath := startFakePodResourcesServer(t, []*podResourcesAPIv1.PodResources{
+		{
+			Namespace: "default",
+			Name:      "inference",
+			Containers: []*podResourcesAPIv1.ContainerResources{
+				{
+					Name: "server",
+					Devices: []*podResourcesAPIv1.ContainerDevices{
+						{ResourceName: "furiosa.ai/rngd", DeviceIds: []string{"A76AAD68-6855-40B1-9E86-D080852D1C80", "A76AAD68-6855-40B1-9E86-D080852D1C81"}},
+					},
+				},
+				{
+					Name: "sidecar",
+				},
+			},
+		},
+		{
+			Namespace: "training",
+			Name:      "trainer",
+			Containers: []*podResourcesAPIv1.ContainerResources{
+				{
+					Name: "main",
+					Devices: []*podResourcesAPIv1.ContainerDevices{
+						{ResourceName: "furiosa.ai/rngd-2core.12gb", DeviceIds: []string{"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_0-1"}},
+						{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"}},
+					},
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		description    string
+		resourceNames  []string
+		expectedResult map[string]Owner
+	}{
+		{
+			description:   "devices of the given resources",
+			resourceNames: []string{"furiosa.ai/rngd", "furiosa.ai/rngd-2core.12gb"},
+			expectedResult: map[string]Owner{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80":           {Namespace: "default", Pod: "inference", Container: "server"},
+				"A76AAD68-6855-40B1-9E86-D080852D1C81":           {Namespace: "default", Pod: "inference", Container: "server"},
+				"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_0-1": {Namespace: "training", Pod: "trainer", Container: "main"},
+			},
+		},
+		{
+			description:   "devices of every resource",
+			resourceNames: nil,
+			expectedResult: map[string]Owner{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80":           {Namespace: "default", Pod: "inference", Container: "server"},
+				"A76AAD68-6855-40B1-9E86-D080852D1C81":           {Namespace: "default", Pod: "inference", Container: "server"},
+				"A76AAD68-6855-40B1-9E86-D080852D1C82_cores_0-1": {Namespace: "training", Pod: "trainer", Container: "main"},
+				"GPU-0": {Namespace: "training", Pod: "trainer", Container: "main"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			client, err := NewClient(socketPath, func() []string { return tc.resourceNames })
+			assert.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+
+			actual, err := client.Owners(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, actual)
+		})
+	}
+}
+
+func TestOwnersWithoutKubelet(t *testing.T) {
+	client, err := NewClient(filepath.Join(t.TempDir(), "missing.sock"), nil)
+	assert.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	_, err = client.Owners(context.Background())
+	assert.Error(t, err)
+}
+
+var _ Client = (*fakeClient)(nil)
+
+type fakeClient struct {
+	owners map[string]Owner
+	err    error
+}
+
+func (f *fakeClient) Owners(_ context.Context) (map[string]Owner, error) {
+	return f.owners, f.err
+}
+
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	owners := map[string]Owner{
+		"A76AAD68-6855-40B1-9E86-D080852D1C81": {Namespace: "default", Pod: "inference", Container: "server"},
+		"A76AAD68-6855-40B1-9E86-D080852D1C80": {Namespace: "training", Pod: "trainer", Container: "main"},
+	}
+
+	tests := []struct {
+		description    string
+		client         Client
+		target         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			description:    "list allocations ordered by device id",
+			client:         &fakeClient{owners: owners},
+			target:         HandlerPath,
+			expectedStatus: http.StatusOK,
+			expectedBody: `[{"deviceID":"A76AAD68-6855-40B1-9E86-D080852D1C80","namespace":"training","pod":"trainer","container":"main"},` +
+				`{"deviceID":"A76AAD68-6855-40B1-9E86-D080852D1C81","namespace":"default","pod":"inference","container":"server"}]`,
+		},
+		{
+			description:    "query an allocated device",
+			client:         &fakeClient{owners: owners},
+			target:         HandlerPath + "?device=A76AAD68-6855-40B1-9E86-D080852D1C81",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"deviceID":"A76AAD68-6855-40B1-9E86-D080852D1C81","namespace":"default","pod":"inference","container":"server"}`,
+		},
+		{
+			description:    "query a free device",
+			client:         &fakeClient{owners: owners},
+			target:         HandlerPath + "?device=A76AAD68-6855-40B1-9E86-D080852D1C82",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			description:    "no allocation",
+			client:         &fakeClient{owners: map[string]Owner{}},
+			target:         HandlerPath,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			description:    "kubelet is not reachable",
+			client:         &fakeClient{err: fmt.Errorf("connection refused")},
+			target:         HandlerPath,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			NewHandler(tc.client).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
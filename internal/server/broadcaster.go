@@ -0,0 +1,79 @@
+package server
+
+import "sync"
+
+// broadcaster notifies every subscriber that the devices should be reported again, publish never blocks.
+// Each subscriber has a single pending notification, so that the notifications are coalesced until the subscriber reads
+// the devices, which are always the latest states including every change since the last read.
+type broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+	closed      bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// subscribe returns the channel of the notifications and the function to unsubscribe.
+// The channel is closed when the broadcaster is closed.
+func (b *broadcaster) subscribe() (<-chan struct{}, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	b.subscribers[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish notifies every subscriber, a subscriber with a pending notification is skipped.
+func (b *broadcaster) publish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// close closes the channel of every subscriber, it is safe to call more than once.
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// len returns the number of subscribers.
+func (b *broadcaster) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
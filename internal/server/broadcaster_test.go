@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pending returns the number of notifications waiting in ch, and whether ch is closed.
+func pending(ch <-chan struct{}) (int, bool) {
+	count := 0
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return count, true
+			}
+			count++
+		default:
+			return count, false
+		}
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	b := newBroadcaster()
+
+	// publish doesn't block without subscribers.
+	b.publish()
+
+	first, unsubscribeFirst := b.subscribe()
+	second, unsubscribeSecond := b.subscribe()
+	assert.Equal(t, 2, b.len())
+
+	// every subscriber gets the notifications, which are coalesced until read.
+	b.publish()
+	b.publish()
+	count, closed := pending(first)
+	assert.Equal(t, 1, count)
+	assert.False(t, closed)
+	count, closed = pending(second)
+	assert.Equal(t, 1, count)
+	assert.False(t, closed)
+
+	// an unsubscribed channel is closed and no longer notified.
+	unsubscribeFirst()
+	unsubscribeFirst()
+	assert.Equal(t, 1, b.len())
+	b.publish()
+	count, closed = pending(first)
+	assert.Equal(t, 0, count)
+	assert.True(t, closed)
+	count, _ = pending(second)
+	assert.Equal(t, 1, count)
+
+	// close ends every subscriber, including the ones subscribing later.
+	b.close()
+	b.close()
+	assert.Equal(t, 0, b.len())
+	_, closed = pending(second)
+	assert.True(t, closed)
+	unsubscribeSecond()
+
+	late, unsubscribeLate := b.subscribe()
+	_, closed = pending(late)
+	assert.True(t, closed)
+	unsubscribeLate()
+	b.publish()
+}
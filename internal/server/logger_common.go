@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 
+	"github.com/rs/zerolog"
+
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
@@ -26,3 +29,14 @@ func getRawJSON(i interface{}) []byte {
 		return marshaled
 	}
 }
+
+// getRequestLogger returns the logger of the plugin server with the id of the request if it is assigned.
+func getRequestLogger(pluginServerCtx context.Context, ctx context.Context) *zerolog.Logger {
+	logger := zerolog.Ctx(pluginServerCtx)
+	if requestID, ok := RequestIDFromContext(ctx); ok {
+		requestLogger := logger.With().Str("request_id", requestID).Logger()
+		return &requestLogger
+	}
+
+	return logger
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"errors"
+	"io"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -26,14 +28,15 @@ func (wss *wrappedServerStream) SendMsg(m interface{}) error {
 	timestamp := time.Now()
 
 	err := wss.ServerStream.SendMsg(m)
+	latency := time.Since(timestamp)
 	if err != nil {
 		event := getNewErrorEventStreamLogger(wss.logger, timestamp, m, wss.info, err)
-		event.Msg("grpc middleware event stream send error logging")
+		event.Dur("latency", latency).Msg("grpc middleware event stream send error logging")
 	}
 
 	if wss.debugMode {
 		event := getNewDebugEventStreamLogger(wss.logger, timestamp, m, wss.info)
-		event.Msg("grpc middleware event stream send debug logging")
+		event.Dur("latency", latency).Msg("grpc middleware event stream send debug logging")
 	}
 
 	return err
@@ -42,15 +45,17 @@ func (wss *wrappedServerStream) SendMsg(m interface{}) error {
 func (wss *wrappedServerStream) RecvMsg(m interface{}) error {
 	timestamp := time.Now()
 
-	err := wss.ServerStream.SendMsg(m)
-	if err != nil {
+	err := wss.ServerStream.RecvMsg(m)
+	latency := time.Since(timestamp)
+	// io.EOF is the end of the client stream rather than an error.
+	if err != nil && !errors.Is(err, io.EOF) {
 		event := getNewErrorEventStreamLogger(wss.logger, timestamp, m, wss.info, err)
-		event.Msg("grpc middleware event stream recv error logging")
+		event.Dur("latency", latency).Msg("grpc middleware event stream recv error logging")
 	}
 
-	if wss.debugMode {
+	if wss.debugMode && err == nil {
 		event := getNewDebugEventStreamLogger(wss.logger, timestamp, m, wss.info)
-		event.Msg("grpc middleware event stream recv debug logging")
+		event.Dur("latency", latency).Msg("grpc middleware event stream recv debug logging")
 	}
 
 	return err
@@ -58,7 +63,8 @@ func (wss *wrappedServerStream) RecvMsg(m interface{}) error {
 
 func NewGrpcLoggerStreamInterceptor(ctx context.Context, debugMode bool) grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		logger := zerolog.Ctx(ctx)
+		timestamp := time.Now()
+		logger := getRequestLogger(ctx, ss.Context())
 
 		wss := &wrappedServerStream{
 			ServerStream: ss,
@@ -68,13 +74,29 @@ func NewGrpcLoggerStreamInterceptor(ctx context.Context, debugMode bool) grpc.St
 			debugMode:    debugMode,
 		}
 
-		return handler(srv, wss)
+		err := handler(srv, wss)
+		latency := time.Since(timestamp)
+		if err != nil {
+			event := getNewErrorEventStreamLogger(logger, timestamp, nil, info, err)
+			event.Dur("latency", latency).Msg("grpc middleware event stream error logging")
+		}
+
+		if debugMode {
+			event := getNewDebugEventStreamLogger(logger, timestamp, nil, info)
+			event.Dur("latency", latency).Msg("grpc middleware event stream closed debug logging")
+		}
+
+		return err
 	}
 }
 
 func getNewErrorEventStreamLogger(logger *zerolog.Logger, time time.Time, m interface{}, info *grpc.StreamServerInfo, err error) *zerolog.Event {
 	statusErr := status.Convert(err)
 	event := logger.Err(err).Time(zerolog.TimestampFieldName, time).Str("method", info.FullMethod).Str("error_code", statusErr.Code().String()).Str("msg", statusErr.Message()).Interface("details", statusErr.Details())
+	if m == nil {
+		return event
+	}
+
 	if raw := getRawJSON(m); raw != nil {
 		event = event.RawJSON("payload", raw)
 	}
@@ -84,6 +106,10 @@ func getNewErrorEventStreamLogger(logger *zerolog.Logger, time time.Time, m inte
 
 func getNewDebugEventStreamLogger(logger *zerolog.Logger, time time.Time, m interface{}, info *grpc.StreamServerInfo) *zerolog.Event {
 	event := logger.Debug().Time(zerolog.TimestampFieldName, time).Str("method", info.FullMethod)
+	if m == nil {
+		return event
+	}
+
 	if raw := getRawJSON(m); raw != nil {
 		event = event.RawJSON("payload", raw)
 	}
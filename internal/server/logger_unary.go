@@ -12,17 +12,18 @@ import (
 func NewGrpcLoggerUnaryInterceptor(pluginServerCtx context.Context, debugMode bool) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		timestamp := time.Now()
-		logger := zerolog.Ctx(pluginServerCtx)
+		logger := getRequestLogger(pluginServerCtx, ctx)
 
 		resp, err := handler(logger.WithContext(ctx), req)
+		latency := time.Since(timestamp)
 		if err != nil {
 			event := getNewErrorEventUnaryLogger(logger, timestamp, req, info, err)
-			event.Msg("grpc middleware event unary error logging")
+			event.Dur("latency", latency).Msg("grpc middleware event unary error logging")
 		}
 
 		if debugMode {
 			event := getNewDebugEventUnaryLogger(logger, timestamp, req, info, resp)
-			event.Msg("grpc middleware event unary debug logging")
+			event.Dur("latency", latency).Msg("grpc middleware event unary debug logging")
 		}
 
 		return resp, err
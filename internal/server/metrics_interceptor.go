@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+func NewGrpcMetricsUnaryInterceptor(resourceName string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		timestamp := time.Now()
+		method := path.Base(info.FullMethod)
+
+		resp, err := handler(ctx, req)
+
+		metrics.GrpcRequestDuration.WithLabelValues(resourceName, method).Observe(time.Since(timestamp).Seconds())
+		metrics.GrpcRequests.WithLabelValues(resourceName, method, status.Code(err).String()).Inc()
+
+		return resp, err
+	}
+}
+
+func NewGrpcMetricsStreamInterceptor(resourceName string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		method := path.Base(info.FullMethod)
+
+		// ListAndWatch is the only stream of the device plugin api, an open stream means kubelet is watching the devices.
+		metrics.ListAndWatchStreams.WithLabelValues(resourceName).Inc()
+		defer metrics.ListAndWatchStreams.WithLabelValues(resourceName).Dec()
+
+		err := handler(srv, ss)
+		metrics.GrpcRequests.WithLabelValues(resourceName, method, status.Code(err).String()).Inc()
+
+		return err
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGrpcMetricsUnaryInterceptor(t *testing.T) {
+	tests := []struct {
+		description  string
+		resourceName string
+		handlerErr   error
+		expectedCode string
+	}{
+		{
+			description:  "successful request",
+			resourceName: "furiosa.ai/test-unary-ok",
+			handlerErr:   nil,
+			expectedCode: codes.OK.String(),
+		},
+		{
+			description:  "failed request",
+			resourceName: "furiosa.ai/test-unary-error",
+			handlerErr:   status.Error(codes.NotFound, "device not found"),
+			expectedCode: codes.NotFound.String(),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			interceptor := NewGrpcMetricsUnaryInterceptor(tc.resourceName)
+			info := &grpc.UnaryServerInfo{FullMethod: "/v1beta1.DevicePlugin/Allocate"}
+
+			_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, tc.handlerErr
+			})
+			assert.Equal(t, tc.handlerErr, err)
+
+			assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GrpcRequests.WithLabelValues(tc.resourceName, "Allocate", tc.expectedCode)))
+		})
+	}
+}
+
+func TestGrpcMetricsStreamInterceptor(t *testing.T) {
+	resourceName := "furiosa.ai/test-stream"
+	interceptor := NewGrpcMetricsStreamInterceptor(resourceName)
+	info := &grpc.StreamServerInfo{FullMethod: "/v1beta1.DevicePlugin/ListAndWatch"}
+
+	err := interceptor(nil, nil, info, func(srv interface{}, stream grpc.ServerStream) error {
+		// the stream is open while the handler is running.
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ListAndWatchStreams.WithLabelValues(resourceName)))
+		return fmt.Errorf("stream closed")
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.ListAndWatchStreams.WithLabelValues(resourceName)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.GrpcRequests.WithLabelValues(resourceName, "ListAndWatch", codes.Unknown.String())))
+}
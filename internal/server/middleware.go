@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// newGrpcServer returns grpc.Server with the middleware chain of the plugin server, the first interceptor is the outermost.
+// The request id is assigned first so that every log of the request carries it, and panics are recovered innermost so
+// that the logs and the metrics see them as Internal errors.
+func newGrpcServer(ctx context.Context, resourceName string, debugMode bool, grpcErrChan chan error) *grpc.Server {
+	return grpc.NewServer(
+		grpc.ChainStreamInterceptor(
+			NewGrpcRequestIDStreamInterceptor(),
+			NewGrpcLoggerStreamInterceptor(ctx, debugMode),
+			NewGrpcMetricsStreamInterceptor(resourceName),
+			NewGrpcRecoveryStreamInterceptor(grpcErrChan),
+		),
+		grpc.ChainUnaryInterceptor(
+			NewGrpcRequestIDUnaryInterceptor(),
+			NewGrpcLoggerUnaryInterceptor(ctx, debugMode),
+			NewGrpcMetricsUnaryInterceptor(resourceName),
+			NewGrpcRecoveryUnaryInterceptor(grpcErrChan),
+		),
+	)
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	devicePluginAPIv1Beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// fakeDevicePlugin responds with the request id of the context, and panics or fails by the requested device id.
+type fakeDevicePlugin struct {
+	devicePluginAPIv1Beta1.UnimplementedDevicePluginServer
+
+	streamPanic bool
+}
+
+func (f *fakeDevicePlugin) Allocate(ctx context.Context, request *devicePluginAPIv1Beta1.AllocateRequest) (*devicePluginAPIv1Beta1.AllocateResponse, error) {
+	switch request.ContainerRequests[0].DevicesIds[0] {
+	case "panic":
+		panic("device is gone")
+	case "error":
+		return nil, status.Error(codes.NotFound, "device not found")
+	}
+
+	requestID, _ := RequestIDFromContext(ctx)
+	return &devicePluginAPIv1Beta1.AllocateResponse{
+		ContainerResponses: []*devicePluginAPIv1Beta1.ContainerAllocateResponse{{Envs: map[string]string{"REQUEST_ID": requestID}}},
+	}, nil
+}
+
+func (f *fakeDevicePlugin) ListAndWatch(_ *devicePluginAPIv1Beta1.Empty, stream devicePluginAPIv1Beta1.DevicePlugin_ListAndWatchServer) error {
+	if f.streamPanic {
+		panic("device is gone")
+	}
+
+	requestID, _ := RequestIDFromContext(stream.Context())
+	for _, id := range []string{requestID, "npu1"} {
+		if err := stream.Send(&devicePluginAPIv1Beta1.ListAndWatchResponse{Devices: []*devicePluginAPIv1Beta1.Device{{ID: id, Health: devicePluginAPIv1Beta1.Healthy}}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncBuffer is bytes.Buffer written by the logger of the server goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newBufconnClient serves the plugin with the middleware chain of the plugin server on an in-memory listener.
+func newBufconnClient(t *testing.T, plugin devicePluginAPIv1Beta1.DevicePluginServer, resourceName string, logs io.Writer, grpcErrChan chan error) devicePluginAPIv1Beta1.DevicePluginClient {
+	listener := bufconn.Listen(1 << 20)
+	ctx := zerolog.New(logs).WithContext(context.Background())
+
+	server := newGrpcServer(ctx, resourceName, true, grpcErrChan)
+	devicePluginAPIv1Beta1.RegisterDevicePluginServer(server, plugin)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return devicePluginAPIv1Beta1.NewDevicePluginClient(conn)
+}
+
+func allocateRequest(deviceID string) *devicePluginAPIv1Beta1.AllocateRequest {
+	return &devicePluginAPIv1Beta1.AllocateRequest{
+		ContainerRequests: []*devicePluginAPIv1Beta1.ContainerAllocateRequest{{DevicesIds: []string{deviceID}}},
+	}
+}
+
+func TestMiddlewareUnary(t *testing.T) {
+	tests := []struct {
+		description       string
+		deviceID          string
+		requestID         string
+		expectedCode      codes.Code
+		expectPanicReport bool
+		expectedLog       string
+	}{
+		{
+			description:  "assign a new request id",
+			deviceID:     "npu0",
+			expectedCode: codes.OK,
+			expectedLog:  "grpc middleware event unary debug logging",
+		},
+		{
+			description:  "keep the request id of the caller",
+			deviceID:     "npu0",
+			requestID:    "kubelet-request",
+			expectedCode: codes.OK,
+			expectedLog:  "grpc middleware event unary debug logging",
+		},
+		{
+			description:  "log the error of the handler",
+			deviceID:     "error",
+			requestID:    "kubelet-request",
+			expectedCode: codes.NotFound,
+			expectedLog:  "grpc middleware event unary error logging",
+		},
+		{
+			description:       "recover a panic of the handler",
+			deviceID:          "panic",
+			requestID:         "kubelet-request",
+			expectedCode:      codes.Internal,
+			expectPanicReport: true,
+			expectedLog:       "panic in /v1beta1.DevicePlugin/Allocate: device is gone",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			logs := &syncBuffer{}
+			grpcErrChan := make(chan error, 1)
+			client := newBufconnClient(t, &fakeDevicePlugin{}, "furiosa.ai/test-middleware-unary", logs, grpcErrChan)
+
+			ctx := context.Background()
+			if tc.requestID != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadataKey, tc.requestID)
+			}
+
+			var header metadata.MD
+			resp, err := client.Allocate(ctx, allocateRequest(tc.deviceID), grpc.Header(&header))
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+
+			requestIDs := header.Get(RequestIDMetadataKey)
+			if !assert.Len(t, requestIDs, 1) {
+				return
+			}
+			if tc.requestID != "" {
+				assert.Equal(t, tc.requestID, requestIDs[0])
+			} else {
+				assert.Len(t, requestIDs[0], 16)
+			}
+
+			if tc.expectedCode == codes.OK {
+				// the handler sees the same request id.
+				assert.Equal(t, requestIDs[0], resp.ContainerResponses[0].Envs["REQUEST_ID"])
+			}
+
+			if tc.expectPanicReport {
+				assert.ErrorContains(t, <-grpcErrChan, "device is gone")
+
+				// the server keeps serving after the panic.
+				_, err = client.Allocate(context.Background(), allocateRequest("npu0"))
+				assert.NoError(t, err)
+			} else {
+				assert.Empty(t, grpcErrChan)
+			}
+
+			// every log of the request carries the request id and the latency.
+			assert.Contains(t, logs.String(), tc.expectedLog)
+			assert.Contains(t, logs.String(), `"request_id":"`+requestIDs[0]+`"`)
+			assert.Contains(t, logs.String(), `"latency":`)
+		})
+	}
+}
+
+func TestMiddlewareStream(t *testing.T) {
+	tests := []struct {
+		description       string
+		streamPanic       bool
+		expectedCode      codes.Code
+		expectPanicReport bool
+		expectedLog       string
+	}{
+		{
+			description:  "stream the responses",
+			expectedCode: codes.OK,
+			expectedLog:  "grpc middleware event stream closed debug logging",
+		},
+		{
+			description:       "recover a panic of the handler",
+			streamPanic:       true,
+			expectedCode:      codes.Internal,
+			expectPanicReport: true,
+			expectedLog:       "panic in /v1beta1.DevicePlugin/ListAndWatch: device is gone",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			logs := &syncBuffer{}
+			grpcErrChan := make(chan error, 1)
+			client := newBufconnClient(t, &fakeDevicePlugin{streamPanic: tc.streamPanic}, "furiosa.ai/test-middleware-stream", logs, grpcErrChan)
+
+			stream, err := client.ListAndWatch(context.Background(), &devicePluginAPIv1Beta1.Empty{})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var deviceIDs []string
+			for {
+				resp, recvErr := stream.Recv()
+				if recvErr != nil {
+					if !errors.Is(recvErr, io.EOF) {
+						err = recvErr
+					}
+					break
+				}
+				deviceIDs = append(deviceIDs, resp.Devices[0].ID)
+			}
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+
+			header, err := stream.Header()
+			assert.NoError(t, err)
+			requestIDs := header.Get(RequestIDMetadataKey)
+			if !assert.Len(t, requestIDs, 1) {
+				return
+			}
+
+			if tc.expectPanicReport {
+				assert.Empty(t, deviceIDs)
+				assert.ErrorContains(t, <-grpcErrChan, "device is gone")
+			} else {
+				// the request is received rather than sent back, so only the responses of the handler are streamed.
+				assert.Equal(t, []string{requestIDs[0], "npu1"}, deviceIDs)
+				assert.Empty(t, grpcErrChan)
+			}
+
+			assert.Contains(t, logs.String(), tc.expectedLog)
+			assert.Contains(t, logs.String(), `"request_id":"`+requestIDs[0]+`"`)
+			assert.Contains(t, logs.String(), `"latency":`)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewGrpcRecoveryUnaryInterceptor turns a panic of the handler into an Internal error instead of crashing the process,
+// and reports it to grpcErrChan so that the device plugin is restarted from a clean state.
+func NewGrpcRecoveryUnaryInterceptor(grpcErrChan chan error) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(ctx, info.FullMethod, r, grpcErrChan)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// NewGrpcRecoveryStreamInterceptor is NewGrpcRecoveryUnaryInterceptor for the streams.
+func NewGrpcRecoveryStreamInterceptor(grpcErrChan chan error) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(ss.Context(), info.FullMethod, r, grpcErrChan)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recoverPanic logs the panic with the stack and reports it without blocking, a pending report is enough to restart.
+func recoverPanic(ctx context.Context, method string, recovered interface{}, grpcErrChan chan error) error {
+	err := fmt.Errorf("panic in %s: %v", method, recovered)
+	zerolog.Ctx(ctx).Error().Str("method", method).Str("stack", string(debug.Stack())).Msg(err.Error())
+
+	select {
+	case grpcErrChan <- err:
+	default:
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
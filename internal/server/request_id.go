@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDMetadataKey is the metadata key of the request id, the id is taken from the request if the caller sets it.
+// The id is returned in the response header and attached to every log of the request.
+const RequestIDMetadataKey = "x-request-id"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the id of the request assigned by the request id interceptor.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok
+}
+
+// withRequestID returns the context of the request with the id from the incoming metadata or a new random id.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadataKey); len(values) > 0 && values[0] != "" {
+			return context.WithValue(ctx, requestIDKey{}, values[0]), values[0]
+		}
+	}
+
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	requestID := hex.EncodeToString(buf)
+
+	return context.WithValue(ctx, requestIDKey{}, requestID), requestID
+}
+
+// contextServerStream overrides the context of grpc.ServerStream.
+type contextServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (css *contextServerStream) Context() context.Context {
+	return css.ctx
+}
+
+func NewGrpcRequestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, requestID := withRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, requestID))
+
+		return handler(ctx, req)
+	}
+}
+
+func NewGrpcRequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, requestID := withRequestID(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIDMetadataKey, requestID))
+
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
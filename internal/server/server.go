@@ -10,7 +10,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
 	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/metrics"
 	"github.com/rs/zerolog"
 	"k8s.io/apimachinery/pkg/util/wait"
 
@@ -27,11 +29,14 @@ var _ devicePluginAPIv1Beta1.DevicePluginServer = (*PluginServer)(nil)
 type PluginServer struct {
 	devicePluginAPIv1Beta1.UnimplementedDevicePluginServer
 
-	cancelCtxFunc         context.CancelFunc
-	deviceManager         device_manager.DeviceManager
-	socket                string
-	server                *grpc.Server
-	deviceHealthCheckChan chan error
+	cancelCtxFunc       context.CancelFunc
+	deviceManager       device_manager.DeviceManager
+	socket              string
+	server              *grpc.Server
+	debugMode           bool
+	healthCheckInterval time.Duration
+	// updates notifies every ListAndWatch stream when the devices or their health are changed.
+	updates *broadcaster
 }
 
 func dialWithTimeout(socket string, timeout time.Duration) (*grpc.ClientConn, error) {
@@ -61,6 +66,8 @@ func dialWithTimeout(socket string, timeout time.Duration) (*grpc.ClientConn, er
 
 func (p *PluginServer) StartWithContext(ctx context.Context, grpcErrChan chan error) error {
 	logger := zerolog.Ctx(ctx)
+	// the grpc server is created here because the recovered panics are reported to grpcErrChan.
+	p.server = newGrpcServer(ctx, p.deviceManager.ResourceName(), p.debugMode, grpcErrChan)
 	devicePluginAPIv1Beta1.RegisterDevicePluginServer(p.server, p)
 
 	err := os.Remove(p.socket)
@@ -94,9 +101,11 @@ func (p *PluginServer) StartWithContext(ctx context.Context, grpcErrChan chan er
 	_ = conn.Close()
 
 	// register to kubelet
+	resourceName := p.deviceManager.ResourceName()
 	conn, err = dialWithTimeout(devicePluginAPIv1Beta1.KubeletSocket, 5*time.Second)
 	if err != nil {
 		logger.Err(err).Msg(fmt.Sprintf("error received from %s dialer", devicePluginAPIv1Beta1.KubeletSocket))
+		metrics.RegistrationAttempts.WithLabelValues(resourceName, metrics.ResultFailure).Inc()
 		return err
 	}
 
@@ -110,34 +119,56 @@ func (p *PluginServer) StartWithContext(ctx context.Context, grpcErrChan chan er
 		},
 	}); err != nil {
 		logger.Err(err).Msg(fmt.Sprintf("couldn't register resource %s", p.deviceManager.ResourceName()))
+		metrics.RegistrationAttempts.WithLabelValues(resourceName, metrics.ResultFailure).Inc()
+		_ = conn.Close()
 		return err
 	}
 
 	logger.Info().Msg(fmt.Sprintf("resource %s is registered to kubelet", p.deviceManager.ResourceName()))
+	metrics.RegistrationAttempts.WithLabelValues(resourceName, metrics.ResultSuccess).Inc()
+	metrics.RegisteredResources.WithLabelValues(resourceName).Set(1)
+	recordDeviceHealth(p.deviceManager)
 
 	_ = conn.Close()
 
 	// start health check loop
 	logger.Info().Msg(fmt.Sprintf("start health check loop for the resource %s", p.deviceManager.ResourceName()))
 
-	//TODO(@bg): parse duration from configuration
 	go wait.UntilWithContext(ctx, func(ctx context.Context) {
 		healthCheckLogger := zerolog.Ctx(ctx)
 
-		healthCheckErr := p.deviceManager.HealthCheck()
-		if healthCheckErr != nil {
-			healthCheckLogger.Err(healthCheckErr).Msg("device health check fail")
+		// notify ListAndWatch only when the health of any device is changed.
+		timestamp := time.Now()
+		healthEvents := p.deviceManager.HealthCheck()
+		metrics.HealthCheckDuration.WithLabelValues(resourceName).Observe(time.Since(timestamp).Seconds())
+		recordDeviceHealth(p.deviceManager)
+
+		if len(healthEvents) == 0 {
+			return
+		}
+
+		for _, healthEvent := range healthEvents {
+			if healthEvent.Current.Healthy {
+				healthCheckLogger.Info().Msg(healthEvent.String())
+			} else {
+				healthCheckLogger.Warn().Msg(healthEvent.String())
+			}
 		}
 
-		p.deviceHealthCheckChan <- healthCheckErr
-	}, 5*time.Second)
+		p.updates.publish()
+	}, p.healthCheckInterval)
 
 	return nil
 }
 
 func (p *PluginServer) Stop() error {
+	// end the ListAndWatch streams
+	p.updates.close()
 	// stop grpc server
-	p.server.Stop()
+	if p.server != nil {
+		p.server.Stop()
+	}
+	metrics.RegisteredResources.WithLabelValues(p.deviceManager.ResourceName()).Set(0)
 	// remove socket
 	_ = os.Remove(p.socket)
 	// stop goroutines associated to plugin server
@@ -152,24 +183,42 @@ func (p *PluginServer) GetDevicePluginOptions(_ context.Context, _ *devicePlugin
 	}, nil
 }
 
+// ListAndWatch subscribes to the updates before sending the initial states, so that no change is missed in between.
+// Every stream gets every change, a reconnecting kubelet doesn't compete with the stream it replaces.
 func (p *PluginServer) ListAndWatch(_ *devicePluginAPIv1Beta1.Empty, deviceMgrSrv devicePluginAPIv1Beta1.DevicePlugin_ListAndWatchServer) error {
+	updates, unsubscribe := p.updates.subscribe()
+	defer unsubscribe()
+
 	logger := zerolog.Ctx(deviceMgrSrv.Context())
 	logger.Info().Msg(fmt.Sprintf("register devices and report initial states for devices %s", strings.Join(p.deviceManager.Devices(), ", ")))
 	if err := deviceMgrSrv.Send(p.deviceManager.GetListAndWatchResponse()); err != nil {
 		return err
 	}
-
-	for healthCheckErr := range p.deviceHealthCheckChan {
-		if healthCheckErr != nil {
-			logger.Info().Msg(fmt.Sprintf("device state updated %s", healthCheckErr))
+	metrics.ListAndWatchUpdates.WithLabelValues(p.deviceManager.ResourceName()).Inc()
+
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				logger.Info().Msg("plugin server is stopped, closing the stream")
+				return nil
+			}
+			logger.Info().Msg(fmt.Sprintf("devices or their health are changed, reporting devices %s", strings.Join(p.deviceManager.Devices(), ", ")))
+		case <-deviceMgrSrv.Context().Done():
+			return nil
 		}
 
 		if err := deviceMgrSrv.Send(p.deviceManager.GetListAndWatchResponse()); err != nil {
 			return err
 		}
+		metrics.ListAndWatchUpdates.WithLabelValues(p.deviceManager.ResourceName()).Inc()
 	}
+}
 
-	return nil
+// NotifyDevicesChanged reports the devices to kubelet again after DeviceManager is updated, it doesn't block.
+// The notifications are coalesced until ListAndWatch sends the devices.
+func (p *PluginServer) NotifyDevicesChanged() {
+	p.updates.publish()
 }
 
 func (p *PluginServer) GetPreferredAllocation(ctx context.Context, request *devicePluginAPIv1Beta1.PreferredAllocationRequest) (*devicePluginAPIv1Beta1.PreferredAllocationResponse, error) {
@@ -224,19 +273,32 @@ func (p *PluginServer) PreStartContainer(_ context.Context, _ *devicePluginAPIv1
 	return &devicePluginAPIv1Beta1.PreStartContainerResponse{}, nil
 }
 
-func NewPluginServerWithContext(ctx context.Context, cancelFunc context.CancelFunc, deviceManager device_manager.DeviceManager, debugMode bool) PluginServer {
+func NewPluginServerWithContext(ctx context.Context, cancelFunc context.CancelFunc, deviceManager device_manager.DeviceManager, cfg *config.Config) PluginServer {
 	// comment(@bg): full resource name is already validated
 	split := strings.SplitN(deviceManager.ResourceName(), "/", 2)
 	resNameWithoutPrefix := split[1]
 
 	return PluginServer{
-		socket:        fmt.Sprintf(socketPathExp, resNameWithoutPrefix),
-		cancelCtxFunc: cancelFunc,
-		deviceManager: deviceManager,
-		server: grpc.NewServer(
-			grpc.StreamInterceptor(NewGrpcLoggerStreamInterceptor(ctx, debugMode)),
-			grpc.UnaryInterceptor(NewGrpcLoggerUnaryInterceptor(ctx, debugMode)),
-		),
-		deviceHealthCheckChan: make(chan error),
+		socket:              fmt.Sprintf(socketPathExp, resNameWithoutPrefix),
+		cancelCtxFunc:       cancelFunc,
+		deviceManager:       deviceManager,
+		debugMode:           cfg.DebugMode,
+		healthCheckInterval: cfg.HealthCheckInterval.Duration,
+		updates:             newBroadcaster(),
+	}
+}
+
+// recordDeviceHealth updates the number of devices by health with the last known states.
+func recordDeviceHealth(deviceManager device_manager.DeviceManager) {
+	healthy, unhealthy := 0, 0
+	for _, state := range deviceManager.HealthStates() {
+		if state.Healthy {
+			healthy++
+		} else {
+			unhealthy++
+		}
 	}
+
+	metrics.Devices.WithLabelValues(deviceManager.ResourceName(), devicePluginAPIv1Beta1.Healthy).Set(float64(healthy))
+	metrics.Devices.WithLabelValues(deviceManager.ResourceName(), devicePluginAPIv1Beta1.Unhealthy).Set(float64(unhealthy))
 }
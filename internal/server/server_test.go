@@ -1,5 +1,20 @@
 package server
 
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/config"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	devicePluginAPIv1Beta1 "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
 /*
 Test grpc handlers
 GetDevicePluginOptions(context.Context, *Empty) (*DevicePluginOptions, error)
@@ -8,3 +23,52 @@ GetContainerPreferredAllocationResponse(context.Context, *PreferredAllocationReq
 Allocate(context.Context, *AllocateRequest) (*AllocateResponse, error)
 PreStartContainer(context.Context, *PreStartContainerRequest) (*PreStartContainerResponse, error)
 */
+
+func TestListAndWatch(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	deviceManager, err := device_manager.NewDeviceManager("furiosa.ai/test-list-and-watch", furiosa_device.NonePolicy, smi.GetStaticMockDevices(smi.ArchRngd), nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(zerolog.Nop().WithContext(context.Background()))
+	pluginServer := NewPluginServerWithContext(ctx, cancel, deviceManager, cfg)
+	client := newBufconnClient(t, &pluginServer, deviceManager.ResourceName(), io.Discard, make(chan error, 1))
+
+	recvDevices := func(stream devicePluginAPIv1Beta1.DevicePlugin_ListAndWatchClient) int {
+		resp, err := stream.Recv()
+		if !assert.NoError(t, err) {
+			return 0
+		}
+
+		return len(resp.Devices)
+	}
+
+	firstCtx, firstCancel := context.WithCancel(context.Background())
+	defer firstCancel()
+	first, err := client.ListAndWatch(firstCtx, &devicePluginAPIv1Beta1.Empty{})
+	assert.NoError(t, err)
+	second, err := client.ListAndWatch(context.Background(), &devicePluginAPIv1Beta1.Empty{})
+	assert.NoError(t, err)
+
+	// every stream gets the initial states and every change.
+	assert.Equal(t, 8, recvDevices(first))
+	assert.Equal(t, 8, recvDevices(second))
+	pluginServer.NotifyDevicesChanged()
+	assert.Equal(t, 8, recvDevices(first))
+	assert.Equal(t, 8, recvDevices(second))
+
+	// the closed stream is unsubscribed, and the remaining stream keeps getting the changes.
+	firstCancel()
+	assert.Eventually(t, func() bool {
+		return pluginServer.updates.len() == 1
+	}, time.Second, time.Millisecond)
+	pluginServer.NotifyDevicesChanged()
+	assert.Equal(t, 8, recvDevices(second))
+
+	// stop ends the streams.
+	assert.NoError(t, pluginServer.Stop())
+	_, err = second.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+	pluginServer.NotifyDevicesChanged()
+}
@@ -0,0 +1,184 @@
+package telemetry
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/health_checker"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/pod_resources"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "furiosa_npu"
+
+	memoryDram        = "dram"
+	memoryDramShared  = "dram_shared"
+	memorySram        = "sram"
+	memoryInstruction = "instruction"
+
+	memoryKindTotal = "total"
+	memoryKindInUse = "in_use"
+)
+
+// deviceLabels are attached to every series. The partition label is the partitioning policy of the card for the
+// series of the whole card, and the device id of the partition containing the PE core for the series of a PE core.
+// The namespace, pod and container labels are the container holding the partition, or the whole card for the series
+// of the whole card, and they are empty if the device is not allocated.
+var deviceLabels = []string{"uuid", "bdf", "arch", "numa", "partition", "namespace", "pod", "container"}
+
+func newDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, withLabels(deviceLabels, labels...), nil)
+}
+
+// withLabels returns a new slice of the labels followed by the extra labels.
+func withLabels(labels []string, extra ...string) []string {
+	return append(append(make([]string, 0, len(labels)+len(extra)), labels...), extra...)
+}
+
+var (
+	powerDesc           = newDesc("power_watts", "Power consumption of the card in watts.")
+	temperatureDesc     = newDesc("temperature_celsius", "Temperature of the card in Celsius by sensor.", "sensor")
+	coreFrequencyDesc   = newDesc("core_frequency_mhz", "Frequency of the PE core in MHz.", "core")
+	memoryFrequencyDesc = newDesc("memory_frequency_mhz", "Frequency of the memory of the card in MHz.")
+	throttleReasonDesc  = newDesc("throttle_reason", "Reason of the card throttling, the value is always 1.", "reason")
+	memoryDesc          = newDesc("memory_bytes", "Memory of the card in bytes by memory type and kind.", "memory", "kind")
+	coreUtilizationDesc = newDesc("core_utilization_percent", "Utilization of the PE core in percent.", "core")
+)
+
+var _ prometheus.Collector = (*collector)(nil)
+
+// collector reads the telemetry of the cards through furiosa-smi whenever the metrics are scraped.
+type collector struct {
+	cards        func() []device_manager.Card
+	observer     smi.Observer
+	podResources pod_resources.Client
+}
+
+// NewCollector returns prometheus.Collector exporting the telemetry of the cards returned by cards at each scrape.
+// The utilization of the PE cores is exported only if the observer is not nil,
+// and the series are attributed to the containers holding the devices only if the pod resources client is not nil.
+func NewCollector(cards func() []device_manager.Card, observer smi.Observer, podResources pod_resources.Client) prometheus.Collector {
+	return &collector{
+		cards:        cards,
+		observer:     observer,
+		podResources: podResources,
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- powerDesc
+	ch <- temperatureDesc
+	ch <- coreFrequencyDesc
+	ch <- memoryFrequencyDesc
+	ch <- throttleReasonDesc
+	ch <- memoryDesc
+	ch <- coreUtilizationDesc
+}
+
+// Collect exports the telemetry of every card, a metric which couldn't be read from the card is skipped.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	owners := c.owners()
+
+	for _, card := range c.cards() {
+		info, err := card.Device.DeviceInfo()
+		if err != nil {
+			continue
+		}
+
+		labels := []string{info.UUID(), info.BDF(), card.Arch.ToString(), strconv.Itoa(int(info.NumaNode()))}
+		cardOwner := cardOwnerOf(card, owners)
+		cardLabels := withLabels(labels, string(card.Policy), cardOwner.Namespace, cardOwner.Pod, cardOwner.Container)
+		coreLabels := func(core uint32) []string {
+			partition, _ := card.PartitionOf(core)
+			owner := owners[partition.ID]
+			return withLabels(labels, partition.ID, owner.Namespace, owner.Pod, owner.Container, strconv.Itoa(int(core)))
+		}
+
+		if power, err := card.Device.PowerConsumption(); err == nil {
+			ch <- prometheus.MustNewConstMetric(powerDesc, prometheus.GaugeValue, power, cardLabels...)
+		}
+
+		if temperature, err := card.Device.DeviceTemperature(); err == nil {
+			ch <- prometheus.MustNewConstMetric(temperatureDesc, prometheus.GaugeValue, temperature.SocPeak(), withLabels(cardLabels, "soc_peak")...)
+			ch <- prometheus.MustNewConstMetric(temperatureDesc, prometheus.GaugeValue, temperature.Ambient(), withLabels(cardLabels, "ambient")...)
+		}
+
+		if coreFrequency, err := card.Device.CoreFrequency(); err == nil {
+			for _, peFrequency := range coreFrequency.PeFrequency() {
+				ch <- prometheus.MustNewConstMetric(coreFrequencyDesc, prometheus.GaugeValue, float64(peFrequency.Frequency()), coreLabels(peFrequency.Core())...)
+			}
+		}
+
+		if memoryFrequency, err := card.Device.MemoryFrequency(); err == nil {
+			ch <- prometheus.MustNewConstMetric(memoryFrequencyDesc, prometheus.GaugeValue, float64(memoryFrequency.Frequency()), cardLabels...)
+		}
+
+		if reason, err := card.Device.ThrottleReason(); err == nil {
+			ch <- prometheus.MustNewConstMetric(throttleReasonDesc, prometheus.GaugeValue, 1, withLabels(cardLabels, health_checker.ThrottleReasonName(reason))...)
+		}
+
+		// MemoryUtilization may return nil without an error if the card doesn't report it.
+		if memoryUtilization, err := card.Device.MemoryUtilization(); err == nil && memoryUtilization != nil {
+			for name, memory := range map[string]smi.Memory{
+				memoryDram:        memoryUtilization.Dram(),
+				memoryDramShared:  memoryUtilization.DramShared(),
+				memorySram:        memoryUtilization.Sram(),
+				memoryInstruction: memoryUtilization.Instruction(),
+			} {
+				if memory == nil {
+					continue
+				}
+
+				var total, inUse uint64
+				for _, block := range memory.Memory() {
+					total += block.TotalBytes()
+					inUse += block.InUseBytes()
+				}
+
+				ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(total), withLabels(cardLabels, name, memoryKindTotal)...)
+				ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(inUse), withLabels(cardLabels, name, memoryKindInUse)...)
+			}
+		}
+
+		if c.observer == nil {
+			continue
+		}
+
+		if coreUtilizations, err := c.observer.GetCoreUtilization(card.Device); err == nil {
+			for _, coreUtilization := range coreUtilizations {
+				ch <- prometheus.MustNewConstMetric(coreUtilizationDesc, prometheus.GaugeValue, coreUtilization.PeUsagePercentage(), coreLabels(coreUtilization.Core())...)
+			}
+		}
+	}
+}
+
+// owners returns the containers holding the devices, the series are not attributed if kubelet can't be reached.
+func (c *collector) owners() map[string]pod_resources.Owner {
+	if c.podResources == nil {
+		return nil
+	}
+
+	owners, err := c.podResources.Owners(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	return owners
+}
+
+// cardOwnerOf returns the container holding every partition of the card, or an empty Owner if there is no such container.
+func cardOwnerOf(card device_manager.Card, owners map[string]pod_resources.Owner) pod_resources.Owner {
+	var cardOwner pod_resources.Owner
+	for i, partition := range card.Partitions {
+		owner, exist := owners[partition.ID]
+		if !exist || (i > 0 && owner != cardOwner) {
+			return pod_resources.Owner{}
+		}
+		cardOwner = owner
+	}
+
+	return cardOwner
+}
@@ -0,0 +1,176 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/pod_resources"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/furiosa-ai/libfuriosa-kubernetes/pkg/furiosa_device"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ pod_resources.Client = (*fakePodResourcesClient)(nil)
+
+type fakePodResourcesClient struct {
+	owners map[string]pod_resources.Owner
+}
+
+func (f *fakePodResourcesClient) Owners(_ context.Context) (map[string]pod_resources.Owner, error) {
+	return f.owners, nil
+}
+
+func (f *fakePodResourcesClient) Close() error {
+	return nil
+}
+
+var _ smi.Observer = (*fakeObserver)(nil)
+
+type fakeObserver struct {
+	utilizations []smi.CoreUtilization
+	destroyed    bool
+}
+
+func (f *fakeObserver) GetCoreUtilization(_ smi.Device) ([]smi.CoreUtilization, error) {
+	return f.utilizations, nil
+}
+
+func (f *fakeObserver) Destroy() {
+	f.destroyed = true
+}
+
+var _ smi.CoreUtilization = (*fakeCoreUtilization)(nil)
+
+type fakeCoreUtilization struct {
+	core       uint32
+	percentage float64
+}
+
+func (f *fakeCoreUtilization) Core() uint32 {
+	return f.core
+}
+
+func (f *fakeCoreUtilization) TimeWindowMil() uint32 {
+	return 500
+}
+
+func (f *fakeCoreUtilization) PeUsagePercentage() float64 {
+	return f.percentage
+}
+
+func newMockCard() device_manager.Card {
+	return device_manager.Card{
+		Device: smi.GetStaticMockDevice(smi.ArchRngd, 0),
+		Arch:   smi.ArchRngd,
+		Policy: furiosa_device.QuadCorePolicy,
+		Partitions: []device_manager.Partition{
+			{ID: "A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3", Start: 0, End: 3},
+			{ID: "A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7", Start: 4, End: 7},
+		},
+	}
+}
+
+func mockCards() []device_manager.Card {
+	return []device_manager.Card{newMockCard()}
+}
+
+func TestCollector(t *testing.T) {
+	tests := []struct {
+		description  string
+		observer     smi.Observer
+		podResources pod_resources.Client
+		metricNames  []string
+		expected     string
+	}{
+		{
+			description: "card metrics are labelled with the partitioning policy",
+			observer:    nil,
+			metricNames: []string{"furiosa_npu_power_watts", "furiosa_npu_temperature_celsius", "furiosa_npu_throttle_reason"},
+			expected: `
+# HELP furiosa_npu_power_watts Power consumption of the card in watts.
+# TYPE furiosa_npu_power_watts gauge
+furiosa_npu_power_watts{arch="rngd",bdf="0000:27:00.0",container="",namespace="",numa="0",partition="quad-core",pod="",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 100
+# HELP furiosa_npu_temperature_celsius Temperature of the card in Celsius by sensor.
+# TYPE furiosa_npu_temperature_celsius gauge
+furiosa_npu_temperature_celsius{arch="rngd",bdf="0000:27:00.0",container="",namespace="",numa="0",partition="quad-core",pod="",sensor="ambient",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 10
+furiosa_npu_temperature_celsius{arch="rngd",bdf="0000:27:00.0",container="",namespace="",numa="0",partition="quad-core",pod="",sensor="soc_peak",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 20
+# HELP furiosa_npu_throttle_reason Reason of the card throttling, the value is always 1.
+# TYPE furiosa_npu_throttle_reason gauge
+furiosa_npu_throttle_reason{arch="rngd",bdf="0000:27:00.0",container="",namespace="",numa="0",partition="quad-core",pod="",reason="none",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 1
+`,
+		},
+		{
+			description: "core metrics are labelled with the partition containing the core",
+			observer: &fakeObserver{utilizations: []smi.CoreUtilization{
+				&fakeCoreUtilization{core: 3, percentage: 42.5},
+				&fakeCoreUtilization{core: 4, percentage: 0},
+			}},
+			metricNames: []string{"furiosa_npu_core_utilization_percent"},
+			expected: `
+# HELP furiosa_npu_core_utilization_percent Utilization of the PE core in percent.
+# TYPE furiosa_npu_core_utilization_percent gauge
+furiosa_npu_core_utilization_percent{arch="rngd",bdf="0000:27:00.0",container="",core="3",namespace="",numa="0",partition="A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3",pod="",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 42.5
+furiosa_npu_core_utilization_percent{arch="rngd",bdf="0000:27:00.0",container="",core="4",namespace="",numa="0",partition="A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7",pod="",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 0
+`,
+		},
+		{
+			description: "series are attributed to the containers holding the devices",
+			observer: &fakeObserver{utilizations: []smi.CoreUtilization{
+				&fakeCoreUtilization{core: 3, percentage: 42.5},
+				&fakeCoreUtilization{core: 4, percentage: 0},
+			}},
+			podResources: &fakePodResourcesClient{owners: map[string]pod_resources.Owner{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3": {Namespace: "default", Pod: "inference", Container: "server"},
+			}},
+			metricNames: []string{"furiosa_npu_power_watts", "furiosa_npu_core_utilization_percent"},
+			expected: `
+# HELP furiosa_npu_power_watts Power consumption of the card in watts.
+# TYPE furiosa_npu_power_watts gauge
+furiosa_npu_power_watts{arch="rngd",bdf="0000:27:00.0",container="",namespace="",numa="0",partition="quad-core",pod="",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 100
+# HELP furiosa_npu_core_utilization_percent Utilization of the PE core in percent.
+# TYPE furiosa_npu_core_utilization_percent gauge
+furiosa_npu_core_utilization_percent{arch="rngd",bdf="0000:27:00.0",container="server",core="3",namespace="default",numa="0",partition="A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3",pod="inference",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 42.5
+furiosa_npu_core_utilization_percent{arch="rngd",bdf="0000:27:00.0",container="",core="4",namespace="",numa="0",partition="A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7",pod="",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 0
+`,
+		},
+		{
+			description: "card metrics are attributed to the container holding every partition",
+			podResources: &fakePodResourcesClient{owners: map[string]pod_resources.Owner{
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_0-3": {Namespace: "default", Pod: "inference", Container: "server"},
+				"A76AAD68-6855-40B1-9E86-D080852D1C80_cores_4-7": {Namespace: "default", Pod: "inference", Container: "server"},
+			}},
+			metricNames: []string{"furiosa_npu_power_watts"},
+			expected: `
+# HELP furiosa_npu_power_watts Power consumption of the card in watts.
+# TYPE furiosa_npu_power_watts gauge
+furiosa_npu_power_watts{arch="rngd",bdf="0000:27:00.0",container="server",namespace="default",numa="0",partition="quad-core",pod="inference",uuid="A76AAD68-6855-40B1-9E86-D080852D1C80"} 100
+`,
+		},
+		{
+			description: "utilization is not exported without observer",
+			observer:    nil,
+			metricNames: []string{"furiosa_npu_core_utilization_percent"},
+			expected:    "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			collector := NewCollector(mockCards, tc.observer, tc.podResources)
+			assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(tc.expected), tc.metricNames...))
+		})
+	}
+}
+
+func TestCollectorCoreFrequency(t *testing.T) {
+	collector := NewCollector(mockCards, nil, nil)
+
+	// one series per PE core.
+	assert.Equal(t, 8, testutil.CollectAndCount(collector, "furiosa_npu_core_frequency_mhz"))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector, "furiosa_npu_memory_frequency_mhz"))
+	// the mock device doesn't report the memory utilization.
+	assert.Equal(t, 0, testutil.CollectAndCount(collector, "furiosa_npu_memory_bytes"))
+}
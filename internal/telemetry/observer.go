@@ -0,0 +1,107 @@
+package telemetry
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+)
+
+var errNoObserver = errors.New("no observer for the cards")
+
+var _ smi.Observer = (*CardsObserver)(nil)
+
+// CardsObserver is smi.Observer of the cards which can change, the observer of furiosa-smi samples only the cards it
+// is created with, so it is recreated whenever the cards are rediscovered.
+type CardsObserver struct {
+	interval    time.Duration
+	newObserver func(devices []smi.Device, interval time.Duration) (smi.Observer, error)
+
+	mu       sync.Mutex
+	uuids    []string
+	observer smi.Observer
+}
+
+// NewCardsObserver returns CardsObserver sampling the performance counters of the cards at the interval.
+func NewCardsObserver(cards []device_manager.Card, interval time.Duration) (*CardsObserver, error) {
+	o := &CardsObserver{
+		interval:    interval,
+		newObserver: newObserver,
+	}
+
+	return o, o.Update(cards)
+}
+
+// Update recreates the observer if the cards differ from the last ones, the previous observer is kept on error and the
+// same cards are not tried again.
+func (o *CardsObserver) Update(cards []device_manager.Card) error {
+	devices := make([]smi.Device, 0, len(cards))
+	uuids := make([]string, 0, len(cards))
+	for _, card := range cards {
+		info, err := card.Device.DeviceInfo()
+		if err != nil {
+			return err
+		}
+
+		devices = append(devices, card.Device)
+		uuids = append(uuids, info.UUID())
+	}
+	slices.Sort(uuids)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.uuids != nil && slices.Equal(o.uuids, uuids) {
+		return nil
+	}
+	o.uuids = uuids
+
+	observer, err := o.newObserver(devices, o.interval)
+	if err != nil {
+		return err
+	}
+
+	if o.observer != nil {
+		o.observer.Destroy()
+	}
+	o.observer = observer
+
+	return nil
+}
+
+func (o *CardsObserver) GetCoreUtilization(device smi.Device) ([]smi.CoreUtilization, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.observer == nil {
+		return nil, errNoObserver
+	}
+
+	return o.observer.GetCoreUtilization(device)
+}
+
+func (o *CardsObserver) Destroy() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.observer != nil {
+		o.observer.Destroy()
+		o.observer = nil
+	}
+}
+
+// newObserver returns smi.Observer sampling the performance counters of the devices at the interval.
+func newObserver(devices []smi.Device, interval time.Duration) (smi.Observer, error) {
+	opt, err := smi.NewOptForObserver()
+	if err != nil {
+		return nil, err
+	}
+
+	opt.SetDevices(devices)
+	opt.SetInterval(uint32(interval.Milliseconds()))
+
+	return smi.CreateObserverWithOpt(opt)
+}
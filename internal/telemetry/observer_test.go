@@ -0,0 +1,84 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/furiosa-ai/furiosa-device-plugin/internal/device_manager"
+	"github.com/furiosa-ai/furiosa-smi-go/pkg/smi"
+	"github.com/stretchr/testify/assert"
+)
+
+func cardsOf(indexes ...int) []device_manager.Card {
+	var cards []device_manager.Card
+	for _, index := range indexes {
+		cards = append(cards, device_manager.Card{Device: smi.GetStaticMockDevice(smi.ArchRngd, index), Arch: smi.ArchRngd})
+	}
+
+	return cards
+}
+
+func TestCardsObserverUpdate(t *testing.T) {
+	var created []*fakeObserver
+	var createdDevices [][]smi.Device
+	failing := false
+
+	observer := &CardsObserver{
+		interval: time.Second,
+		newObserver: func(devices []smi.Device, _ time.Duration) (smi.Observer, error) {
+			if failing {
+				return nil, errors.New("failed")
+			}
+
+			created = append(created, &fakeObserver{utilizations: []smi.CoreUtilization{&fakeCoreUtilization{core: uint32(len(devices))}}})
+			createdDevices = append(createdDevices, devices)
+			return created[len(created)-1], nil
+		},
+	}
+
+	coreOf := func() uint32 {
+		utilizations, err := observer.GetCoreUtilization(nil)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return utilizations[0].Core()
+	}
+
+	_, err := observer.GetCoreUtilization(nil)
+	assert.Error(t, err)
+
+	assert.NoError(t, observer.Update(cardsOf(0, 1)))
+	assert.Len(t, created, 1)
+	assert.Equal(t, uint32(2), coreOf())
+
+	// the same cards in another order are observed already.
+	assert.NoError(t, observer.Update(cardsOf(1, 0)))
+	assert.Len(t, created, 1)
+
+	// a hot-plugged card is observed by a new observer.
+	assert.NoError(t, observer.Update(cardsOf(0, 1, 2)))
+	assert.Len(t, created, 2)
+	assert.True(t, created[0].destroyed)
+	assert.Equal(t, cardsOf(0, 1, 2)[2].Device, createdDevices[1][2])
+	assert.Equal(t, uint32(3), coreOf())
+
+	// the previous observer is kept if the observer for the new cards can't be created.
+	failing = true
+	assert.Error(t, observer.Update(cardsOf(0)))
+	assert.False(t, created[1].destroyed)
+	assert.Equal(t, uint32(3), coreOf())
+
+	// the same cards are not tried again until the cards change.
+	failing = false
+	assert.NoError(t, observer.Update(cardsOf(0)))
+	assert.Len(t, created, 2)
+	assert.NoError(t, observer.Update(cardsOf(0, 2)))
+	assert.Len(t, created, 3)
+	assert.True(t, created[1].destroyed)
+
+	observer.Destroy()
+	assert.True(t, created[2].destroyed)
+	_, err = observer.GetCoreUtilization(nil)
+	assert.Error(t, err)
+}